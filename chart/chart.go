@@ -0,0 +1,190 @@
+// Package chart turns stored results into go-echarts charts; it's the
+// visualisation layer shared by the generateChart command and the HTTP server.
+package chart
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fwielstra/crntmetrics/domain"
+	"github.com/go-echarts/go-echarts/v2/charts"
+	"github.com/go-echarts/go-echarts/v2/components"
+	"github.com/go-echarts/go-echarts/v2/opts"
+)
+
+const dateFormat = "2006-01-02 15:04:05"
+
+// NewLine creates a line chart with the old and CRNT result counts over time,
+// summed over all projects, and the conversion percentage on a secondary axis.
+// The conversion is projected until old usages reach zero, using the trend
+// that fits best. Changes to the query's definition are marked with a vertical
+// line. The names of the projects the results are from are shown as subtitle.
+func NewLine(title string, results []domain.ResultRow, projectNames domain.ProjectNames) *charts.Line {
+	return newLine(title, projectsSubtitle(results, projectNames), domain.Snapshots(results), domain.VersionChanges(results))
+}
+
+// NewOverview creates a page with a chart of the old and CRNT usages of all
+// queries combined, followed by a smaller chart per query.
+func NewOverview(title string, results []domain.ResultRow, projectNames domain.ProjectNames) *components.Page {
+	byQuery := make(map[string][]domain.ResultRow)
+	for _, res := range results {
+		byQuery[res.QueryName] = append(byQuery[res.QueryName], res)
+	}
+
+	queries := make([]string, 0, len(byQuery))
+	for query := range byQuery {
+		queries = append(queries, query)
+	}
+	slices.Sort(queries)
+
+	page := components.NewPage()
+	page.SetPageTitle(title)
+	page.SetLayout(components.PageFlexLayout)
+
+	total := newLine(title, fmt.Sprintf("All %d queries combined", len(queries)), domain.CombinedSnapshots(results), domain.VersionChanges(results))
+	total.SetGlobalOptions(charts.WithInitializationOpts(opts.Initialization{Width: "1200px", Height: "500px"}))
+	page.AddCharts(total)
+
+	for _, query := range queries {
+		line := NewLine(query, byQuery[query], projectNames)
+		line.SetGlobalOptions(charts.WithInitializationOpts(opts.Initialization{Width: "600px", Height: "320px"}))
+		page.AddCharts(line)
+	}
+
+	return page
+}
+
+func newLine(title string, subtitle string, snapshots []domain.Snapshot, changes []domain.VersionChange) *charts.Line {
+	line := charts.NewLine()
+	line.SetGlobalOptions(
+		charts.WithTitleOpts(opts.Title{Title: title, Subtitle: subtitle}),
+		charts.WithTooltipOpts(opts.Tooltip{Trigger: "axis"}),
+		charts.WithLegendOpts(opts.Legend{Right: "5%"}),
+		charts.WithYAxisOpts(opts.YAxis{Name: "Usages"}),
+	)
+	line.ExtendYAxis(opts.YAxis{
+		Name:      "Conversion",
+		Min:       0,
+		Max:       100,
+		AxisLabel: &opts.AxisLabel{Formatter: "{value} %"},
+		SplitLine: &opts.SplitLine{Show: opts.Bool(false)},
+	})
+
+	dates := make([]string, len(snapshots))
+	old := make([]opts.LineData, len(snapshots))
+	crnt := make([]opts.LineData, len(snapshots))
+	conversion := make([]opts.LineData, len(snapshots))
+	for i, res := range snapshots {
+		dates[i] = res.Timestamp.Format(dateFormat)
+		old[i] = opts.LineData{Value: res.OldResults}
+		crnt[i] = opts.LineData{Value: res.CrntResults}
+		conversion[i] = opts.LineData{Value: percentage(res.Conversion())}
+	}
+
+	line.SetXAxis(dates).
+		AddSeries("Old", old, versionMarks(changes)...).
+		AddSeries("CRNT", crnt).
+		AddSeries("Conversion %", conversion, charts.WithLineChartOpts(opts.LineChart{YAxisIndex: 1}))
+
+	if forecast, ok := domain.BestForecast(snapshots); ok && !forecast.Done {
+		addProjection(line, dates, forecast, snapshots)
+	}
+
+	return line
+}
+
+// versionMarks marks the changes to query definitions with a vertical line,
+// labeled with the query and its new version.
+func versionMarks(changes []domain.VersionChange) []charts.SeriesOpts {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	marks := make([]opts.MarkLineNameXAxisItem, len(changes))
+	for i, c := range changes {
+		marks[i] = opts.MarkLineNameXAxisItem{
+			Name:  fmt.Sprintf("%s changed to %s", c.Query, c.To),
+			XAxis: c.Timestamp.Format(dateFormat),
+		}
+	}
+
+	return []charts.SeriesOpts{
+		charts.WithMarkLineNameXAxisItemOpts(marks...),
+		charts.WithMarkLineStyleOpts(opts.MarkLineStyle{
+			Symbol:    []string{"none", "none"},
+			Label:     &opts.Label{Show: opts.Bool(true), Formatter: "{b}", Position: "insideEndTop"},
+			LineStyle: &opts.LineStyle{Type: "dashed", Color: "#999"},
+		}),
+	}
+}
+
+// projectionSteps is the number of points the projection is drawn with.
+const projectionSteps = 10
+
+// addProjection adds the projected conversion, dashed, and its confidence band
+// to the chart, from the latest snapshot until the projected completion. If
+// the completion isn't in sight, it's projected as far ahead as the history
+// goes back.
+func addProjection(line *charts.Line, dates []string, forecast domain.Forecast, snapshots []domain.Snapshot) {
+	first, latest := snapshots[0].Timestamp, snapshots[len(snapshots)-1].Timestamp
+	end := forecast.Completion
+	if end.IsZero() {
+		end = latest.Add(latest.Sub(first))
+	}
+	if !end.After(latest) {
+		return
+	}
+	step := end.Sub(latest) / projectionSteps
+
+	// the projection starts at the latest snapshot, so there are no values
+	// for the ones before it.
+	var projected, lower, upper []opts.LineData
+	for range len(dates) - 1 {
+		projected = append(projected, opts.LineData{Value: "-"})
+		lower = append(lower, opts.LineData{Value: "-"})
+		upper = append(upper, opts.LineData{Value: "-"})
+	}
+
+	for i := 0; i <= projectionSteps; i++ {
+		t := latest.Add(time.Duration(i) * step)
+		if i > 0 {
+			dates = append(dates, t.Format(dateFormat))
+		}
+
+		value, lo, hi := forecast.Conversion(t)
+		projected = append(projected, opts.LineData{Value: percentage(value)})
+		lower = append(lower, opts.LineData{Value: percentage(lo)})
+		upper = append(upper, opts.LineData{Value: percentage(hi)})
+	}
+
+	band := []charts.SeriesOpts{
+		charts.WithLineChartOpts(opts.LineChart{YAxisIndex: 1, ShowSymbol: opts.Bool(false)}),
+		charts.WithLineStyleOpts(opts.LineStyle{Type: "dotted", Opacity: opts.Float(0.5)}),
+	}
+
+	line.SetXAxis(dates).
+		AddSeries(fmt.Sprintf("Projected %% (%s)", forecast.Model), projected,
+			charts.WithLineChartOpts(opts.LineChart{YAxisIndex: 1}),
+			charts.WithLineStyleOpts(opts.LineStyle{Type: "dashed"}),
+		).
+		AddSeries("95% confidence", lower, band...).
+		AddSeries("95% confidence", upper, band...)
+}
+
+func percentage(ratio float64) float64 {
+	return math.Round(ratio*1000) / 10
+}
+
+func projectsSubtitle(results []domain.ResultRow, projectNames domain.ProjectNames) string {
+	var names []string
+	for _, res := range results {
+		name := projectNames.Name(res.ProjectID)
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
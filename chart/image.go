@@ -0,0 +1,212 @@
+package chart
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/fwielstra/crntmetrics/domain"
+	gochart "github.com/wcharczuk/go-chart/v2"
+	"github.com/wcharczuk/go-chart/v2/drawing"
+)
+
+// ImageFormat is a format charts can be rendered to as a static image, for
+// places that can't show the interactive HTML charts, like chat and email.
+type ImageFormat string
+
+const (
+	SVG ImageFormat = "svg"
+	PNG ImageFormat = "png"
+)
+
+// ParseImageFormat parses svg or png.
+func ParseImageFormat(value string) (ImageFormat, error) {
+	switch format := ImageFormat(value); format {
+	case SVG, PNG:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown image format %q, expected svg or png", value)
+}
+
+// ContentType is the MIME type of images in the format.
+func (f ImageFormat) ContentType() string {
+	if f == PNG {
+		return "image/png"
+	}
+	return "image/svg+xml"
+}
+
+// the size of images, and the colors of the series, matching the default
+// palette of the HTML charts.
+const (
+	imageWidth  = 1200
+	imageHeight = 500
+)
+
+var (
+	oldColor        = drawing.ColorFromHex("5470c6")
+	crntColor       = drawing.ColorFromHex("91cc75")
+	conversionColor = drawing.ColorFromHex("fac858")
+	changeColor     = drawing.ColorFromHex("999999")
+)
+
+// WriteLineImage renders the same chart as NewLine as a static image: the old
+// and CRNT result counts over time, the conversion percentage on a secondary
+// axis, and changes to the query's definition as dashed vertical lines. The
+// projection is left out.
+func WriteLineImage(w io.Writer, format ImageFormat, title string, results []domain.ResultRow) error {
+	return writeImage(w, format, title, domain.Snapshots(results), domain.VersionChanges(results))
+}
+
+// WriteOverviewImage renders the chart of all queries combined of
+// NewOverview as a static image, without the charts per query.
+func WriteOverviewImage(w io.Writer, format ImageFormat, title string, results []domain.ResultRow) error {
+	return writeImage(w, format, title, domain.CombinedSnapshots(results), domain.VersionChanges(results))
+}
+
+func writeImage(w io.Writer, format ImageFormat, title string, snapshots []domain.Snapshot, changes []domain.VersionChange) error {
+	if len(snapshots) == 0 {
+		return errors.New("chart.writeImage(): no results to chart")
+	}
+
+	timestamps := make([]time.Time, len(snapshots))
+	old := make([]float64, len(snapshots))
+	crnt := make([]float64, len(snapshots))
+	conversion := make([]float64, len(snapshots))
+	maxUsages := 0
+	for i, s := range snapshots {
+		timestamps[i] = s.Timestamp
+		old[i] = float64(s.OldResults)
+		crnt[i] = float64(s.CrntResults)
+		conversion[i] = percentage(s.Conversion())
+		maxUsages = max(maxUsages, s.OldResults, s.CrntResults)
+	}
+
+	// go-chart can't draw an empty range, so a single snapshot gets a day
+	// around it and all zeroes a usage axis up to 1.
+	from, to := timestamps[0], timestamps[len(timestamps)-1]
+	if !to.After(from) {
+		from, to = from.Add(-12*time.Hour), to.Add(12*time.Hour)
+	}
+
+	// dates repeat on the axis if the history is only a few days long.
+	xFormat := time.DateOnly
+	if to.Sub(from) < 10*24*time.Hour {
+		xFormat = "2006-01-02 15:04"
+	}
+
+	xAxis := gochart.XAxis{
+		ValueFormatter: gochart.TimeValueFormatterWithFormat(xFormat),
+		Range:          &gochart.ContinuousRange{Min: gochart.TimeToFloat64(from), Max: gochart.TimeToFloat64(to)},
+		// only the changes get a vertical line, not every tick.
+		GridMajorStyle: gochart.Style{Hidden: len(changes) == 0, StrokeColor: changeColor, StrokeWidth: 1, StrokeDashArray: []float64{5, 5}},
+		GridMinorStyle: gochart.Hidden(),
+	}
+	for _, c := range changes {
+		xAxis.GridLines = append(xAxis.GridLines, gochart.GridLine{Value: gochart.TimeToFloat64(c.Timestamp)})
+	}
+
+	usagesMax := niceMax(maxUsages)
+	series := []gochart.TimeSeries{
+		{Name: "Old", XValues: timestamps, YValues: old, Style: lineStyle(oldColor)},
+		{Name: "CRNT", XValues: timestamps, YValues: crnt, Style: lineStyle(crntColor)},
+		{Name: "Conversion %", XValues: timestamps, YValues: conversion, Style: lineStyle(conversionColor), YAxis: gochart.YAxisSecondary},
+	}
+
+	// go-chart draws the primary y-axis on the right, unlike the HTML charts.
+	// Only it gets explicit ticks, as go-chart would apply them to the range
+	// of the secondary axis as well.
+	graph := gochart.Chart{
+		Title:  title,
+		Width:  imageWidth,
+		Height: imageHeight,
+		Background: gochart.Style{
+			// room for the title above and the legend below the chart.
+			Padding: gochart.Box{Top: 50, Left: 20, Right: 20, Bottom: 40},
+		},
+		XAxis: xAxis,
+		YAxis: gochart.YAxis{
+			Name:  "Usages",
+			Range: &gochart.ContinuousRange{Min: 0, Max: usagesMax},
+			Ticks: usageTicks(usagesMax),
+		},
+		YAxisSecondary: gochart.YAxis{
+			Name:           "Conversion",
+			Range:          &gochart.ContinuousRange{Min: 0, Max: 100},
+			ValueFormatter: func(v any) string { return fmt.Sprintf("%.0f %%", v) },
+		},
+		Elements: []gochart.Renderable{legend(series)},
+	}
+	for _, s := range series {
+		graph.Series = append(graph.Series, s)
+	}
+
+	renderer := gochart.SVG
+	if format == PNG {
+		renderer = gochart.PNG
+	}
+	return graph.Render(renderer, w)
+}
+
+// yTicks is the number of ticks on the y-axes, excluding zero.
+const yTicks = 5
+
+// niceMax rounds the maximum up to a number that divides into yTicks round
+// ticks, e.g. 450 to 500.
+func niceMax(maximum int) float64 {
+	step := float64(max(maximum, 1)) / yTicks
+	magnitude := math.Pow(10, math.Floor(math.Log10(step)))
+	for _, nice := range []float64{1, 2, 2.5, 5, 10} {
+		if nice*magnitude >= step {
+			step = nice * magnitude
+			break
+		}
+	}
+	return math.Max(step, 1) * yTicks
+}
+
+func usageTicks(maximum float64) []gochart.Tick {
+	ticks := make([]gochart.Tick, yTicks+1)
+	for i := range ticks {
+		value := maximum * float64(i) / yTicks
+		ticks[i] = gochart.Tick{Value: value, Label: fmt.Sprintf("%.0f", value)}
+	}
+	return ticks
+}
+
+// legend draws the names of the series centered below the chart. The legends
+// of go-chart itself are drawn over the title.
+func legend(series []gochart.TimeSeries) gochart.Renderable {
+	return func(r gochart.Renderer, canvas gochart.Box, defaults gochart.Style) {
+		text := gochart.Style{FontSize: 10, FontColor: drawing.ColorFromHex("333333")}.InheritFrom(defaults)
+		text.WriteTextOptionsToRenderer(r)
+
+		const sample, gap = 20, 25
+		width := 0
+		for _, s := range series {
+			width += sample + 5 + r.MeasureText(s.Name).Width() + gap
+		}
+
+		x := canvas.Left + (canvas.Width()-width+gap)/2
+		y := imageHeight - 12
+		for _, s := range series {
+			r.SetStrokeColor(s.Style.StrokeColor)
+			r.SetStrokeWidth(2)
+			r.SetStrokeDashArray(nil)
+			r.MoveTo(x, y-4)
+			r.LineTo(x+sample, y-4)
+			r.Stroke()
+
+			text.WriteTextOptionsToRenderer(r)
+			r.Text(s.Name, x+sample+5, y)
+			x += sample + 5 + r.MeasureText(s.Name).Width() + gap
+		}
+	}
+}
+
+func lineStyle(color drawing.Color) gochart.Style {
+	// dots show single snapshots, which have no line to draw.
+	return gochart.Style{StrokeColor: color, StrokeWidth: 2, DotColor: color, DotWidth: 3}
+}
@@ -0,0 +1,137 @@
+package chart
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fwielstra/crntmetrics/domain"
+)
+
+func TestParseImageFormat(t *testing.T) {
+	tests := []struct {
+		value       string
+		format      ImageFormat
+		contentType string
+		err         bool
+	}{
+		{"svg", SVG, "image/svg+xml", false},
+		{"png", PNG, "image/png", false},
+		{"SVG", "", "", true},
+		{"html", "", "", true},
+		{"", "", "", true},
+	}
+
+	for _, tt := range tests {
+		format, err := ParseImageFormat(tt.value)
+		if (err != nil) != tt.err {
+			t.Errorf("ParseImageFormat(%q) error = %v, want error %v", tt.value, err, tt.err)
+			continue
+		}
+		if format != tt.format {
+			t.Errorf("ParseImageFormat(%q) = %q, want %q", tt.value, format, tt.format)
+		}
+		if !tt.err && format.ContentType() != tt.contentType {
+			t.Errorf("%s.ContentType() = %q, want %q", format, format.ContentType(), tt.contentType)
+		}
+	}
+}
+
+func TestNiceMax(t *testing.T) {
+	tests := []struct {
+		maximum int
+		want    float64
+	}{
+		// at least a tick per usage, even without any.
+		{0, 5},
+		{1, 5},
+		{5, 5},
+		{7, 10},
+		{12, 12.5},
+		{40, 50},
+		{100, 100},
+		{101, 125},
+		{1234, 1250},
+	}
+
+	for _, tt := range tests {
+		if got := niceMax(tt.maximum); got != tt.want {
+			t.Errorf("niceMax(%d) = %v, want %v", tt.maximum, got, tt.want)
+		}
+	}
+}
+
+func TestUsageTicks(t *testing.T) {
+	tests := []struct {
+		maximum float64
+		want    string
+	}{
+		{5, "0 1 2 3 4 5"},
+		{50, "0 10 20 30 40 50"},
+		{1250, "0 250 500 750 1000 1250"},
+	}
+
+	for _, tt := range tests {
+		ticks := usageTicks(tt.maximum)
+
+		labels := make([]string, len(ticks))
+		for i, tick := range ticks {
+			labels[i] = tick.Label
+		}
+		if got := strings.Join(labels, " "); got != tt.want {
+			t.Errorf("usageTicks(%v) = %s, want %s", tt.maximum, got, tt.want)
+		}
+		if last := ticks[len(ticks)-1].Value; last != tt.maximum {
+			t.Errorf("usageTicks(%v) ends at %v, want the maximum", tt.maximum, last)
+		}
+	}
+}
+
+func TestWriteLineImage(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2025, 6, d, 12, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name    string
+		results []domain.ResultRow
+	}{
+		{"single snapshot", []domain.ResultRow{
+			{Timestamp: day(1), ProjectID: 62, QueryName: "icon", OldResults: 10, CrntResults: 5},
+		}},
+		{"all zero", []domain.ResultRow{
+			{Timestamp: day(1), ProjectID: 62, QueryName: "icon"},
+			{Timestamp: day(2), ProjectID: 62, QueryName: "icon"},
+		}},
+		{"version change", []domain.ResultRow{
+			{Timestamp: day(1), ProjectID: 62, QueryName: "icon", QueryHash: "a", OldResults: 10},
+			{Timestamp: day(8), ProjectID: 62, QueryName: "icon", QueryHash: "b", OldResults: 8, CrntResults: 4},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var svg bytes.Buffer
+			if err := WriteLineImage(&svg, SVG, "icon", tt.results); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(svg.String(), "<svg") || !strings.Contains(svg.String(), "icon") {
+				t.Errorf("expected an SVG with the title, got %.100s", svg.String())
+			}
+
+			var img bytes.Buffer
+			if err := WriteLineImage(&img, PNG, "icon", tt.results); err != nil {
+				t.Fatal(err)
+			}
+			config, err := png.DecodeConfig(&img)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Width != imageWidth || config.Height != imageHeight {
+				t.Errorf("expected a %dx%d PNG, got %dx%d", imageWidth, imageHeight, config.Width, config.Height)
+			}
+		})
+	}
+}
@@ -0,0 +1,344 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fwielstra/crntmetrics/config"
+	"github.com/fwielstra/crntmetrics/domain"
+	"github.com/fwielstra/crntmetrics/localsearch"
+	"github.com/spf13/cobra"
+)
+
+// backfillOptions are the flags of the backfill command.
+type backfillOptions struct {
+	repos       []string
+	interval    string
+	branch      string
+	since       string
+	until       string
+	instance    bool
+	dontPersist bool
+	output      outputFormat
+}
+
+// NewBackfillCmd creates the backfill command, which measures the query pairs
+// at past commits of local clones.
+func NewBackfillCmd() *cobra.Command {
+	var opts backfillOptions
+
+	cmd := &cobra.Command{
+		Use:   "backfill",
+		Short: "Measures the query pairs in the git history of local clones",
+		Long: `Replays the history of the default branch of local clones, given with
+--repo projectId=path, to fill in the adoption curve from before results were
+collected. The state of the branch at the end of every day, week or month is
+searched with the local search backend. The results are stored with the end
+of the period as timestamp rather than the time of the commit, so the results
+of all clones line up, and with the SHA of the last commit before it.
+
+The history of a query pair stops at the first regular update of the project,
+so the counts of the local search backend and of Gitlab don't alternate.
+
+Query pairs that target a project only apply to its clone, and pairs that
+target a group to the clones of projects in the group, which needs the
+namespaces from projects sync. Pairs that target the instance are only
+backfilled with --instance.
+
+Only the git objects are read, the working tree of the clone is left alone.
+Periods that were already backfilled for a query pair are skipped, so a
+backfill can be interrupted and resumed, or rerun after adding a query pair.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg, err := config.Load(config.Path(configPath))
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			if err := backfill(cmd.Context(), store, cfg, opts); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringArrayVar(&opts.repos, "repo", nil, "Local clone of a project, as projectId=path; can be repeated")
+	cmd.Flags().StringVar(&opts.interval, "interval", "weekly", "How often to sample the history: daily, weekly or monthly")
+	cmd.Flags().StringVar(&opts.branch, "branch", "", "Branch to replay (default is the default branch of each clone)")
+	cmd.Flags().StringVar(&opts.since, "since", "", "Only sample periods ending on or after this date, as YYYY-MM-DD")
+	cmd.Flags().StringVar(&opts.until, "until", "", "Only sample periods ending on or before this date, as YYYY-MM-DD (default now); never past the first update of a query")
+	cmd.Flags().BoolVar(&opts.instance, "instance", false, "Also backfill the query pairs that target the whole instance, for every clone")
+	cmd.Flags().BoolVar(&opts.dontPersist, "dontPersist", false, "Search the history but do not persist the results in the database")
+	addOutputFlag(cmd, &opts.output)
+
+	return cmd
+}
+
+// backfill replays the history of every repository and stores the results,
+// recording the backfill as a run. Results are stored per period, so an
+// interrupted backfill keeps what it did so far.
+func backfill(ctx context.Context, store domain.Storage, cfg *config.Config, opts backfillOptions) error {
+	clones, err := parseClones(opts.repos)
+	if err != nil {
+		return err
+	}
+
+	interval, err := localsearch.ParseInterval(opts.interval)
+	if err != nil {
+		return err
+	}
+
+	since, err := parseDate(opts.since)
+	if err != nil {
+		return fmt.Errorf("invalid --since: %w", err)
+	}
+	until, err := parseDate(opts.until)
+	if err != nil {
+		return fmt.Errorf("invalid --until: %w", err)
+	}
+
+	// group targets only apply to clones of projects in the group, which is
+	// known from the synced projects.
+	namespaces, err := store.LoadProjectNamespaces()
+	if err != nil {
+		return fmt.Errorf("error loading project namespaces: %w", err)
+	}
+
+	run := &domain.Run{
+		StartedAt:   time.Now(),
+		GitlabURL:   "backfill:" + strings.Join(opts.repos, ","),
+		ConfigHash:  cfg.Hash,
+		ToolVersion: toolVersion(),
+		Status:      domain.RunStatusRunning,
+	}
+
+	if !opts.dontPersist {
+		if err := store.StartRun(run); err != nil {
+			return err
+		}
+		log.Printf("started run %d", run.ID)
+	}
+
+	var resultRows []domain.ResultRow
+	var errs []error
+	// the number of samples that were searched or failed, so the run's
+	// status compares failures to attempts like update does per query.
+	attempted := 0
+
+	for _, c := range clones {
+		if ctx.Err() != nil {
+			break
+		}
+
+		rows, tries, repoErrs := backfillClone(ctx, store, c, cfg.QueryPairs, namespaces, interval, since, until, opts, run.ID)
+		resultRows = append(resultRows, rows...)
+		errs = append(errs, repoErrs...)
+		attempted += tries
+	}
+
+	if ctx.Err() != nil {
+		log.Printf("backfill stopped early: %v", context.Cause(ctx))
+		errs = append(errs, fmt.Errorf("backfill stopped early: %w", context.Cause(ctx)))
+		attempted++
+	}
+
+	if !opts.dontPersist {
+		// the history is searched with today's definitions, so they're only
+		// valid from now on rather than from the backfilled timestamps.
+		versions := domain.QueryVersions(cfg.QueryPairs, resultRows)
+		for i := range versions {
+			versions[i].ValidFrom = run.StartedAt
+		}
+		if err := store.SaveQueryVersions(versions); err != nil {
+			errs = append(errs, fmt.Errorf("error saving query versions: %w", err))
+			attempted++
+		}
+	}
+
+	run.Finish(time.Now(), max(attempted, 1), errs)
+
+	if !opts.dontPersist {
+		if err := store.FinishRun(run); err != nil {
+			return err
+		}
+		log.Printf("finished run %d with status %s", run.ID, run.Status)
+	}
+
+	projectNames, err := store.LoadProjectNames()
+	if err != nil {
+		return fmt.Errorf("error loading project names: %w", err)
+	}
+
+	writeTable(opts.output, "Backfilled results", resultRows, projectNames)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("backfill finished with %d errors:\n%w", len(errs), errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// backfillClone searches the sampled commits of a single clone for
+// the query pairs that apply to its project, skipping periods that were
+// already backfilled, and stores the results of every period. It returns the
+// new results, the number of attempts and the errors, one per failed attempt:
+// every sample searched counts as an attempt, as does every step before
+// searching that failed, like compiling a query or listing the commits.
+func backfillClone(ctx context.Context, store domain.Storage, c clone, queryPairs []domain.QueryPair, namespaces map[int]string, interval localsearch.Interval, since, until time.Time, opts backfillOptions, runID int64) ([]domain.ResultRow, int, []error) {
+	var errs []error
+	var pairs []domain.QueryPair
+	var matchers []localsearch.Matcher
+	attempted := 0
+
+	for _, qp := range queryPairs {
+		if !appliesTo(qp.Scope, c.projectID, namespaces[c.projectID], opts.instance) {
+			continue
+		}
+
+		old, err1 := localsearch.Compile(qp.Old)
+		crnt, err2 := localsearch.Compile(qp.Crnt)
+		if err := errors.Join(err1, err2); err != nil {
+			errs = append(errs, fmt.Errorf("query %s: %w", qp.Name, err))
+			attempted++
+			continue
+		}
+
+		pairs = append(pairs, qp)
+		matchers = append(matchers, old, crnt)
+	}
+
+	if len(pairs) == 0 {
+		log.Printf("no query pairs to backfill for project %d", c.projectID)
+		return nil, attempted, errs
+	}
+
+	branch := opts.branch
+	if branch == "" {
+		var err error
+		if branch, err = localsearch.DefaultBranch(c.dir); err != nil {
+			return nil, attempted + 1, append(errs, fmt.Errorf("project %d: %w", c.projectID, err))
+		}
+	}
+
+	commits, err := localsearch.ListCommits(c.dir, branch)
+	if err != nil {
+		return nil, attempted + 1, append(errs, fmt.Errorf("project %d: %w", c.projectID, err))
+	}
+
+	if until.IsZero() {
+		until = time.Now()
+	}
+	samples := localsearch.SampleCommits(commits, interval, until)
+	samples = slices.DeleteFunc(samples, func(sample localsearch.Sample) bool {
+		return !since.IsZero() && sample.At.Before(since)
+	})
+
+	done := map[int64]map[string]bool{}
+	if !opts.dontPersist {
+		if done, err = store.LoadBackfilledTimes(c.projectID); err != nil {
+			return nil, attempted + 1, append(errs, err)
+		}
+	}
+
+	// the history stops where regular updates start, so the results of the
+	// local matcher and of Gitlab don't alternate.
+	updated, err := store.LoadFirstUpdateTimes(c.projectID)
+	if err != nil {
+		return nil, attempted + 1, append(errs, err)
+	}
+	skip := func(sample localsearch.Sample, qp domain.QueryPair) bool {
+		first, exists := updated[qp.Name]
+		return done[sample.At.UnixMilli()][qp.Name] || (exists && !sample.At.Before(first))
+	}
+
+	log.Printf("backfilling %d samples of %s in project %d", len(samples), branch, c.projectID)
+
+	var resultRows []domain.ResultRow
+
+	// periods without commits repeat the commit before them, which only
+	// needs to be searched once.
+	var searchedSHA string
+	var results [][]*domain.SearchResult
+
+	for _, sample := range samples {
+		if ctx.Err() != nil {
+			break
+		}
+
+		if !slices.ContainsFunc(pairs, func(qp domain.QueryPair) bool { return !skip(sample, qp) }) {
+			continue
+		}
+		attempted++
+
+		if sample.Commit.SHA != searchedSHA {
+			searchedSHA = ""
+			results, err = localsearch.Search(ctx, localsearch.Repository{
+				ProjectID: c.projectID,
+				Tree:      localsearch.GitTree{Dir: c.dir, Commit: sample.Commit.SHA},
+				Ref:       sample.Commit.SHA,
+			}, matchers...)
+			if err != nil {
+				if ctx.Err() == nil {
+					errs = append(errs, fmt.Errorf("project %d, commit %s: %w", c.projectID, sample.Commit.SHA, err))
+				}
+				continue
+			}
+			searchedSHA = sample.Commit.SHA
+		}
+
+		var rows []domain.ResultRow
+		for i, qp := range pairs {
+			if skip(sample, qp) {
+				continue
+			}
+
+			rows = append(rows, domain.ResultRow{
+				RunID:       runID,
+				Timestamp:   sample.At,
+				ProjectID:   c.projectID,
+				QueryName:   qp.Name,
+				QueryHash:   qp.Hash(),
+				OldResults:  len(results[2*i]),
+				CrntResults: len(results[2*i+1]),
+				CommitSHA:   sample.Commit.SHA,
+			})
+		}
+		log.Printf("searched commit %s for %s", shortHash(sample.Commit.SHA), sample.At.Format(time.DateOnly))
+
+		if !opts.dontPersist {
+			if err := store.SaveResults(rows); err != nil {
+				return resultRows, attempted, append(errs, fmt.Errorf("error saving results: %w", err))
+			}
+		}
+		resultRows = append(resultRows, rows...)
+	}
+
+	return resultRows, attempted, errs
+}
+
+// appliesTo returns whether a query pair with this scope searches the project,
+// given the full path of its namespace. A group target applies to the
+// projects in the group and its subgroups by path; groups given by ID can't
+// be matched and never apply. Instance targets only apply if includeInstance
+// is set, as a clone could be of a project on another instance.
+func appliesTo(scope domain.Scope, projectID int, namespace string, includeInstance bool) bool {
+	switch {
+	case scope.Instance:
+		return includeInstance
+	case scope.Group != "":
+		group := strings.Trim(scope.Group, "/")
+		return namespace != "" && (namespace == group || strings.HasPrefix(namespace, group+"/"))
+	}
+	return slices.Contains(scope.ProjectIDs, projectID)
+}
+
+// parseDate parses an optional YYYY-MM-DD date in the local timezone.
+func parseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.ParseInLocation(time.DateOnly, value, time.Local)
+}
@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+
+	"github.com/fwielstra/crntmetrics/config"
+	"github.com/fwielstra/crntmetrics/domain"
+	"github.com/fwielstra/crntmetrics/export"
+	"github.com/spf13/cobra"
+)
+
+// NewExportCmd creates the export command, which writes all stored history to
+// JSON Lines or CSV so it can be imported into another database.
+func NewExportCmd() *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "export [path]",
+		Short: "Exports results, runs, projects and query definitions",
+		Long: `Exports all results, runs, projects and query versions in the database, and
+the query definitions of the config file, to be imported into another database
+with the import command.
+
+With --format jsonl, the default, everything is written to a single file, or
+to stdout if no path or - is given. With --format csv, a file per kind of
+record is written to the directory at path.`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			path := "-"
+			if len(args) > 0 {
+				path = args[0]
+			}
+
+			data, err := loadExport()
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			switch format {
+			case "jsonl":
+				err = writeJSONLExport(path, data)
+			case "csv":
+				if path == "-" {
+					log.Fatal("--format csv needs a directory to write to")
+				}
+				err = export.WriteCSV(path, data)
+			default:
+				log.Fatalf("unknown export format %q, expected jsonl or csv", format)
+			}
+			if err != nil {
+				log.Fatalf("error writing export: %v", err)
+			}
+
+			log.Printf("exported %d results, %d runs, %d projects, %d queries and %d query versions", len(data.Results), len(data.Runs), len(data.Projects), len(data.Queries), len(data.QueryVersions))
+		},
+	}
+	cmd.Flags().StringVarP(&format, "format", "f", "jsonl", "Export format: jsonl or csv")
+
+	return cmd
+}
+
+// loadExport loads everything to export. The query definitions are optional,
+// as history can be exported without a config file.
+func loadExport() (export.Data, error) {
+	var data export.Data
+	var err error
+
+	if data.Results, err = store.LoadResults(); err != nil {
+		return data, fmt.Errorf("error loading results: %w", err)
+	}
+	if data.Runs, err = store.LoadRuns(math.MaxInt32); err != nil {
+		return data, fmt.Errorf("error loading runs: %w", err)
+	}
+	if data.Projects, err = store.LoadProjects(); err != nil {
+		return data, fmt.Errorf("error loading projects: %w", err)
+	}
+	if data.QueryVersions, err = store.LoadQueryVersions(); err != nil {
+		return data, fmt.Errorf("error loading query versions: %w", err)
+	}
+
+	cfg, err := config.Load(config.Path(configPath))
+	if err != nil {
+		log.Printf("not exporting query definitions: %v", err)
+		return data, nil
+	}
+	for _, qp := range cfg.QueryPairs {
+		data.Queries = append(data.Queries, export.NewQuery(qp))
+	}
+
+	return data, nil
+}
+
+func writeJSONLExport(path string, data export.Data) error {
+	if path == "-" {
+		return export.WriteJSONL(os.Stdout, data)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := export.WriteJSONL(f, data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// NewImportCmd creates the import command, which loads an export into the
+// database, skipping what's already there.
+func NewImportCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "import path",
+		Short: "Imports results, runs and projects from an export",
+		Long: `Imports an export made with the export command: a JSON Lines file, or - for
+stdin, or a directory of CSV files.
+
+Results that already exist, with the same timestamp, project and query, are
+skipped, as are runs that started at the same time on the same Gitlab, so
+importing the same export twice, or merging two databases that were copied
+from each other, doesn't duplicate anything. Known projects are updated with
+the exported names and URLs. The import runs in a single transaction, so if it
+fails, nothing is imported and it can simply be retried.
+
+Query versions are imported, but the query definitions of the config file
+aren't, as they live in the config file; the exported definitions that are
+missing from or differ from the config file are listed instead.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			data, err := readExport(args[0])
+			if err != nil {
+				log.Fatalf("error reading export: %v", err)
+			}
+
+			// projects without a name were only referenced by results, there's
+			// nothing to cache.
+			var projects []*domain.Project
+			for i := range data.Projects {
+				if data.Projects[i].Name != "" {
+					projects = append(projects, &data.Projects[i])
+				}
+			}
+
+			counts, err := store.Import(domain.History{
+				Runs:          data.Runs,
+				Results:       data.Results,
+				Projects:      projects,
+				QueryVersions: data.QueryVersions,
+			})
+			if err != nil {
+				log.Fatalf("error importing, nothing was imported: %v", err)
+			}
+
+			log.Printf("imported %d of %d results and %d of %d runs, the rest already existed", counts.Results, len(data.Results), counts.Runs, len(data.Runs))
+			log.Printf("imported %d projects and %d query versions", len(projects), len(data.QueryVersions))
+
+			compareQueries(data.Queries)
+		},
+	}
+}
+
+func readExport(path string) (export.Data, error) {
+	if path == "-" {
+		return export.ReadJSONL(os.Stdin)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return export.Data{}, err
+	}
+	if info.IsDir() {
+		return export.ReadCSV(path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return export.Data{}, err
+	}
+	defer f.Close()
+
+	return export.ReadJSONL(f)
+}
+
+// compareQueries logs the exported query definitions that are missing from or
+// differ from the config file, so they can be added by hand.
+func compareQueries(queries []export.Query) {
+	if len(queries) == 0 {
+		return
+	}
+
+	cfg, err := config.Load(config.Path(configPath))
+	if err != nil {
+		log.Printf("not comparing query definitions: %v", err)
+		return
+	}
+
+	configured := make(map[string]export.Query, len(cfg.QueryPairs))
+	for _, qp := range cfg.QueryPairs {
+		configured[qp.Name] = export.NewQuery(qp)
+	}
+
+	for _, q := range queries {
+		current, exists := configured[q.Name]
+		switch {
+		case !exists:
+			log.Printf("query %q is not in %s: old %q, crnt %q", q.Name, cfg.Path, q.Old, q.Crnt)
+		case current.Old != q.Old || current.Crnt != q.Crnt:
+			log.Printf("query %q differs from %s: exported old %q, crnt %q", q.Name, cfg.Path, q.Old, q.Crnt)
+		}
+	}
+}
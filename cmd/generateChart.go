@@ -4,68 +4,111 @@ Copyright © 2025 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
-	"database/sql"
 	"fmt"
+	"io"
 	"log"
 	"os"
 
-	"github.com/fwielstra/crntmetrics/domain"
-	"github.com/fwielstra/crntmetrics/sqlite"
-	"github.com/go-echarts/go-echarts/v2/charts"
-	"github.com/go-echarts/go-echarts/v2/opts"
+	"github.com/fwielstra/crntmetrics/chart"
 	"github.com/spf13/cobra"
 )
 
-func NewGenerateChartCmd(db *sql.DB) *cobra.Command {
-	return &cobra.Command{
+func NewGenerateChartCmd() *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
 		Use:   "generateChart",
 		Short: "Generates a chart for all results or the specified command",
-		Long:  ``,
+		Long: `Generates a HTML chart of the old and CRNT usages and the conversion
+percentage over time of the given query, written to <query>.html.
+
+Without a query, or with "all", it generates all.html with a chart of all
+queries combined, followed by a smaller chart per query.
+
+With --format svg or png, the chart is rendered as a static image instead, to
+embed in chat, email or documents, written to <query>.svg or <query>.png. For
+all queries, the image only has the combined chart.`,
 		Run: func(cmd *cobra.Command, args []string) {
 			query := "all"
 			if len(args) > 0 {
 				query = args[0]
 			}
 
-			var results []domain.ResultRow
-			var err error
+			var imageFormat chart.ImageFormat
+			if format != "html" {
+				var err error
+				if imageFormat, err = chart.ParseImageFormat(format); err != nil {
+					log.Fatal(err)
+				}
+			}
+
+			projectNames, err := store.LoadProjectNames()
+			if err != nil {
+				log.Fatal(err)
+			}
 
 			if query == "all" {
-				results, err = sqlite.LoadResults(db)
-			} else {
-				results, err = sqlite.LoadQueryResults(db, query)
+				results, err := store.LoadResults()
+				if err != nil {
+					log.Fatal(err)
+				}
+
+				title := "CRNT Adoption Rate"
+				if imageFormat != "" {
+					writeImage(query, imageFormat, func(w io.Writer) error {
+						return chart.WriteOverviewImage(w, imageFormat, title, results)
+					})
+					return
+				}
+
+				writeChart(query, chart.NewOverview(title, results, projectNames))
+				return
 			}
 
+			results, err := store.LoadQueryResults(query)
 			if err != nil {
 				log.Fatal(err)
 			}
 
-			writeChart(fmt.Sprintf("CRNT Adoption Rate for %s", query), query, results)
+			title := fmt.Sprintf("CRNT Adoption Rate for %s", query)
+			if imageFormat != "" {
+				writeImage(query, imageFormat, func(w io.Writer) error {
+					return chart.WriteLineImage(w, imageFormat, title, results)
+				})
+				return
+			}
+
+			writeChart(query, chart.NewLine(title, results, projectNames))
 		},
 	}
+	cmd.Flags().StringVarP(&format, "format", "f", "html", "Chart format: html for an interactive chart, or svg or png for a static image")
+
+	return cmd
 }
 
-func writeChart(title string, filename string, results []domain.ResultRow) {
-	bar := charts.NewLine()
-	bar.SetGlobalOptions(charts.WithTitleOpts(opts.Title{
-		Title: title,
-	}))
-
-	dates := make([]string, len(results))
-	old := make([]opts.LineData, len(results))
-	crnt := make([]opts.LineData, len(results))
-	for i, res := range results {
-		dates[i] = res.Timestamp.Format("2006-01-02 15:04:05")
-		old[i] = opts.LineData{Value: res.OldResults}
-		crnt[i] = opts.LineData{Value: res.CrntResults}
-	}
+// renderer is implemented by both single charts and pages of charts.
+type renderer interface {
+	Render(w io.Writer) error
+}
+
+func writeChart(filename string, r renderer) {
+	writeFile(fmt.Sprintf("%s.html", filename), r.Render)
+}
 
-	bar.SetXAxis(dates).
-		AddSeries("Old", old).
-		AddSeries("CRNT", crnt)
+func writeImage(filename string, format chart.ImageFormat, render func(w io.Writer) error) {
+	writeFile(fmt.Sprintf("%s.%s", filename, format), render)
+}
 
-	f, _ := os.Create(fmt.Sprintf("%s.html", filename))
-	bar.Render(f)
+func writeFile(filename string, render func(w io.Writer) error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		log.Fatalf("error creating chart file: %v", err)
+	}
+	defer f.Close()
+
+	if err := render(f); err != nil {
+		log.Fatalf("error rendering chart: %v", err)
+	}
 
 	log.Printf("generated chart at %s", f.Name())
 }
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/fwielstra/crntmetrics/glclient"
+	"golang.org/x/time/rate"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+const defaultGitlabURL = "https://gitlab.essent.nl/api/v4"
+
+// default search rate limit in requests per second and burst size; matches
+// Gitlab's default search rate limit of 30 requests per minute.
+const (
+	defaultSearchRate  = 0.5
+	defaultSearchBurst = 10
+)
+
+// gitlabURL returns the Gitlab API URL, which can be overridden with the
+// GITLAB_URL environment variable.
+func gitlabURL() string {
+	if url, exists := os.LookupEnv("GITLAB_URL"); exists && url != "" {
+		return url
+	}
+	return defaultGitlabURL
+}
+
+// custom logger to allow for custom date/time format
+// see https://stackoverflow.com/questions/26152993/go-logger-to-print-timestamp
+type writer struct {
+	io.Writer
+	timeFormat string
+}
+
+func (w writer) Write(b []byte) (n int, err error) {
+	return w.Writer.Write(append([]byte(time.Now().Format(w.timeFormat)), b...))
+}
+
+type gitlabLogger struct {
+	log *log.Logger
+}
+
+func (c *gitlabLogger) Printf(format string, v ...interface{}) {
+	c.log.Printf(format, v...)
+}
+
+// newGitlabClient creates and configures a Gitlab API client using the access
+// token in the PRIVATE_TOKEN environment variable. Extra options are applied
+// after the defaults.
+func newGitlabClient(extraOptions ...gitlab.ClientOptionFunc) (*gitlab.Client, error) {
+	privateToken, exists := os.LookupEnv("PRIVATE_TOKEN")
+	if !exists {
+		return nil, fmt.Errorf("GitLab access token not set in environment variable PRIVATE_TOKEN")
+	}
+
+	options := []gitlab.ClientOptionFunc{}
+	options = append(options, gitlab.WithBaseURL(gitlabURL()))
+	options = append(options, gitlab.WithCustomLogger(&gitlabLogger{log: log.New(&writer{os.Stderr, time.RFC3339Nano}, " [gitlab] ", 0)}))
+	options = append(options, extraOptions...)
+
+	client, err := gitlab.NewClient(privateToken, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gitlab client: %w", err)
+	}
+
+	return client, nil
+}
+
+// newGitlabSearch creates a Gitlab searcher limited to searchRate requests per
+// second, 0 meaning no limit, retrying failed requests with the given policy.
+func newGitlabSearch(searchRate float64, searchBurst int, retry glclient.RetryPolicy) (*glclient.Search, error) {
+	// retries are handled by glclient.Search, so the client shouldn't retry on its own as well.
+	client, err := newGitlabClient(gitlab.WithoutRetries())
+	if err != nil {
+		return nil, err
+	}
+
+	search := &glclient.Search{
+		Client:  client,
+		Verbose: true,
+		Retry:   retry,
+	}
+
+	if searchRate > 0 {
+		search.Limiter = rate.NewLimiter(rate.Limit(searchRate), max(searchBurst, 1))
+	}
+
+	return search, nil
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"log"
+	"os"
+
+	"github.com/fwielstra/crntmetrics/domain"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+)
+
+// NewMigrateCmd creates the migrate command and its subcommands. Migrations
+// are applied on startup, so this is mainly for inspecting the schema version.
+func NewMigrateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Inspects the database schema migrations",
+		Long: `Database schema migrations are embedded in the binary and applied
+automatically when any other command starts. Use the subcommands to inspect
+them, or to apply them without doing anything else.`,
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "status",
+		Short: "Lists all migrations and whether they have been applied",
+		Long: `Lists all migrations and whether they have been applied. Unlike other
+commands, this doesn't apply pending migrations first, so it shows what the
+next command will apply.`,
+		Annotations: map[string]string{skipMigrateAnnotation: ""},
+		Run: func(cmd *cobra.Command, args []string) {
+			statuses, err := store.MigrationStatuses()
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			writeMigrationStatuses(statuses)
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:         "up",
+		Short:       "Applies all pending migrations",
+		Annotations: map[string]string{skipMigrateAnnotation: ""},
+		Run: func(cmd *cobra.Command, args []string) {
+			applied, err := store.Migrate()
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			log.Printf("applied %d migrations", applied)
+		},
+	})
+
+	return cmd
+}
+
+func writeMigrationStatuses(statuses []domain.MigrationStatus) {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetTitle("Database migrations")
+	t.AppendHeader(table.Row{"Version", "Name", "Applied at"})
+
+	for _, status := range statuses {
+		appliedAt := "pending"
+		if status.Applied {
+			appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		t.AppendRow(table.Row{status.Version, status.Name, appliedAt})
+	}
+	t.Render()
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+)
+
+// outputFormat is the format commands write their results in, set with
+// --output. It implements pflag.Value so invalid formats are rejected when
+// parsing the flags.
+type outputFormat string
+
+const (
+	outputTable    outputFormat = "table"
+	outputJSON     outputFormat = "json"
+	outputCSV      outputFormat = "csv"
+	outputMarkdown outputFormat = "markdown"
+)
+
+func (f *outputFormat) String() string {
+	return string(*f)
+}
+
+func (f *outputFormat) Set(value string) error {
+	switch format := outputFormat(value); format {
+	case outputTable, outputJSON, outputCSV, outputMarkdown:
+		*f = format
+		return nil
+	}
+	return fmt.Errorf("expected table, json, csv or markdown")
+}
+
+func (f *outputFormat) Type() string {
+	return "format"
+}
+
+// addOutputFlag adds the --output flag to a command, defaulting to a table.
+func addOutputFlag(cmd *cobra.Command, format *outputFormat) {
+	*format = outputTable
+	cmd.Flags().VarP(format, "output", "o", "Output format: table, json, csv or markdown")
+}
+
+// render writes the table to stdout in the output format. For JSON, the
+// table is ignored and data, the values the table was built from, is written
+// instead, so no information is lost to formatting.
+func (f outputFormat) render(t table.Writer, data any) {
+	t.SetOutputMirror(os.Stdout)
+
+	switch f {
+	case outputJSON:
+		writeJSON(data)
+	case outputCSV:
+		// a title line would break reading the CSV in a spreadsheet.
+		t.SetTitle("")
+		t.RenderCSV()
+	case outputMarkdown:
+		t.RenderMarkdown()
+		fmt.Println()
+	default:
+		t.Render()
+	}
+}
+
+// writeJSON writes v to stdout as indented JSON.
+func writeJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Fatalf("error writing JSON: %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"log"
+
+	"github.com/fwielstra/crntmetrics/glclient"
+	"github.com/spf13/cobra"
+)
+
+// NewProjectsCmd creates the projects command and its subcommands.
+func NewProjectsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "projects",
+		Short: "Manages the cached list of Gitlab projects",
+		Long: `Project names and URLs are cached in the database, so tables and charts
+can show a readable name instead of a project ID.`,
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "sync",
+		Short: "Fetches all projects from Gitlab and stores them in the database",
+		Run: func(cmd *cobra.Command, args []string) {
+			client, err := newGitlabClient()
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			projects, err := glclient.ListProjects(cmd.Context(), client)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			log.Printf("fetched %d projects from API", len(projects))
+
+			if err := store.SaveProjects(projects); err != nil {
+				log.Fatalf("error saving projects: %v", err)
+			}
+
+			log.Printf("saved %d projects", len(projects))
+		},
+	})
+
+	return cmd
+}
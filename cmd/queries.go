@@ -0,0 +1,272 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fwielstra/crntmetrics/config"
+	"github.com/fwielstra/crntmetrics/domain"
+	"github.com/fwielstra/crntmetrics/glclient"
+	"github.com/fwielstra/crntmetrics/localsearch"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/spf13/cobra"
+)
+
+// NewQueriesCmd creates the queries command and its subcommands.
+func NewQueriesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "queries",
+		Short: "Works with the configured query pairs",
+	}
+
+	validate := &cobra.Command{
+		Use:   "validate [query...]",
+		Short: "Checks the query pairs and runs them once against Gitlab",
+		Long: `Parses the old and new query of every configured pair, or of the given pairs,
+and flags syntax errors such as unbalanced quotes, unsupported or misspelled
+filters and suspicious quoting. Then runs each query once against Gitlab and
+shows its number of hits and a sample of matching snippets, without storing
+anything. Queries without hits are flagged as well, since they would only add
+a flat line of zeros to the history.
+
+Exits with an error if any query has a problem.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg, err := config.Load(config.Path(configPath))
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			queryPairs, err := selectQueryPairs(cfg.QueryPairs, args)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			offline, _ := cmd.Flags().GetBool("offline")
+			samples, _ := cmd.Flags().GetInt("samples")
+
+			var search *glclient.Search
+			if !offline {
+				if search, err = newGitlabSearch(defaultSearchRate, defaultSearchBurst, glclient.DefaultRetryPolicy); err != nil {
+					log.Fatal(err)
+				}
+				search.Verbose = false
+			}
+
+			validations := validateQueries(cmd.Context(), search, queryPairs, samples)
+
+			projectNames, err := store.LoadProjectNames()
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			writeValidations(validations, projectNames)
+
+			failed := 0
+			for _, v := range validations {
+				if len(v.problems) > 0 {
+					failed++
+				}
+			}
+			if failed > 0 {
+				log.Fatalf("%d of %d queries have problems", failed, len(validations))
+			}
+		},
+	}
+	validate.Flags().Bool("offline", false, "Only check the syntax of the queries, don't run them against Gitlab")
+	validate.Flags().IntP("samples", "n", 3, "Number of matching snippets to show per query")
+
+	cmd.AddCommand(validate)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "versions [query...]",
+		Short: "Lists every definition the query pairs had",
+		Long: `Lists the definitions of every query pair, or of the given pairs, that results
+were measured with, and since when. A query pair gets a new version whenever
+its scope or either of its queries changes; charts mark where a new version
+was first used, since a change to a query can explain a jump in the results.
+
+Results from before versions were recorded don't have a version.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			versions, err := store.LoadQueryVersions()
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			if len(args) > 0 {
+				versions = slices.DeleteFunc(versions, func(v domain.QueryVersion) bool {
+					return !slices.Contains(args, v.Query)
+				})
+			}
+
+			writeQueryVersions(versions)
+		},
+	})
+
+	return cmd
+}
+
+func writeQueryVersions(versions []domain.QueryVersion) {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetTitle("Query versions")
+	t.AppendHeader(table.Row{"Query", "Version", "Valid from", "Scope", "Old", "CRNT"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, AutoMerge: true},
+		{Number: 5, WidthMax: 50, WidthMaxEnforcer: text.WrapSoft},
+		{Number: 6, WidthMax: 50, WidthMaxEnforcer: text.WrapSoft},
+	})
+
+	for _, v := range versions {
+		t.AppendRow(table.Row{v.Query, v.Hash, v.ValidFrom.Format(time.DateTime), formatScope(v.Scope), v.Old, v.Crnt})
+	}
+	t.Render()
+}
+
+// formatScope describes what a query pair searches.
+func formatScope(scope domain.Scope) string {
+	switch {
+	case scope.Instance:
+		return "instance"
+	case scope.Group != "":
+		return "group " + scope.Group
+	}
+
+	ids := make([]string, len(scope.ProjectIDs))
+	for i, id := range scope.ProjectIDs {
+		ids[i] = strconv.Itoa(id)
+	}
+	return "projects " + strings.Join(ids, ", ")
+}
+
+// selectQueryPairs returns the query pairs with the given names, or all of
+// them if no names are given.
+func selectQueryPairs(queryPairs []domain.QueryPair, names []string) ([]domain.QueryPair, error) {
+	if len(names) == 0 {
+		return queryPairs, nil
+	}
+
+	selected := make([]domain.QueryPair, 0, len(names))
+	for _, name := range names {
+		i := slices.IndexFunc(queryPairs, func(qp domain.QueryPair) bool { return qp.Name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown query pair %q", name)
+		}
+		selected = append(selected, queryPairs[i])
+	}
+
+	return selected, nil
+}
+
+// queryValidation is the outcome of validating one query of a pair.
+type queryValidation struct {
+	pair     string
+	side     string
+	query    string
+	problems []string
+	// hits is -1 if the query didn't run.
+	hits    int
+	samples []*domain.SearchResult
+}
+
+// validateQueries checks the syntax of both queries of every pair, and runs
+// them if search isn't nil. Queries with syntax errors are still run, since
+// Gitlab may interpret them differently than the local parser. Running a query
+// takes a single request, or one per project, for both its hits and samples.
+func validateQueries(ctx context.Context, search *glclient.Search, queryPairs []domain.QueryPair, samples int) []queryValidation {
+	var validations []queryValidation
+
+	for _, qp := range queryPairs {
+		for _, side := range []struct{ name, query string }{{"old", qp.Old}, {"crnt", qp.Crnt}} {
+			v := queryValidation{
+				pair:     qp.Name,
+				side:     side.name,
+				query:    side.query,
+				problems: localsearch.Lint(side.query),
+				hits:     -1,
+			}
+
+			if search != nil {
+				log.Printf("Running %s query of %s...", side.name, qp.Name)
+
+				hits, results, err := search.SampleCode(ctx, side.query, qp.Scope, samples)
+				if err != nil {
+					v.problems = append(v.problems, fmt.Sprintf("search failed: %v", err))
+				} else {
+					v.hits = hits
+					v.samples = results
+					if v.hits == 0 {
+						v.problems = append(v.problems, "no hits")
+					}
+				}
+			}
+
+			validations = append(validations, v)
+		}
+	}
+
+	return validations
+}
+
+func writeValidations(validations []queryValidation, projectNames domain.ProjectNames) {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetTitle("Query validation")
+	t.AppendHeader(table.Row{"Query", "Side", "Search", "Hits", "Problems"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, AutoMerge: true},
+		{Number: 3, WidthMax: 60, WidthMaxEnforcer: text.WrapSoft},
+		{Number: 5, WidthMax: 60, WidthMaxEnforcer: text.WrapSoft},
+	})
+
+	for _, v := range validations {
+		hits := "-"
+		if v.hits >= 0 {
+			hits = fmt.Sprint(v.hits)
+		}
+
+		problems := "ok"
+		if len(v.problems) > 0 {
+			problems = strings.Join(v.problems, "\n")
+		}
+
+		t.AppendRow(table.Row{v.pair, v.side, v.query, hits, problems})
+	}
+	t.Render()
+
+	s := table.NewWriter()
+	s.SetOutputMirror(os.Stdout)
+	s.SetTitle("Sample matches")
+	s.AppendHeader(table.Row{"Query", "Side", "Project", "File", "Snippet"})
+	s.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, AutoMerge: true},
+	})
+
+	for _, v := range validations {
+		for _, res := range v.samples {
+			s.AppendRow(table.Row{v.pair, v.side, projectNames.Name(res.ProjectID), fmt.Sprintf("%s:%d", res.Path, res.StartLine), snippet(res.Snippet)})
+		}
+	}
+
+	if s.Length() > 0 {
+		s.Render()
+	}
+}
+
+// snippet trims a search result snippet to its non-empty lines, truncated to
+// fit a table cell.
+func snippet(data string) string {
+	var lines []string
+	for _, line := range strings.Split(data, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, text.Trim(line, 80))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/fwielstra/crntmetrics/config"
+	"github.com/fwielstra/crntmetrics/domain"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+)
+
+// NewReportCmd creates the report command, which outputs the adoption per query pair.
+func NewReportCmd() *cobra.Command {
+	var output outputFormat
+	var model string
+
+	cmd := &cobra.Command{
+		Use:   "report",
+		Short: "Reports the CRNT adoption per query pair",
+		Long: `Reports the conversion percentage, crnt / (old + crnt), for every configured
+query pair, how it changed since the first and previous snapshots, and how
+many old usages were removed and CRNT usages added since the first snapshot.
+
+It also forecasts when old usages reach zero, by fitting a trend to the
+conversion over time: linear, assuming a constant number of usages is converted
+per day, or logistic, an S-curve that slows down for the last usages. By
+default the trend that fits best is used. The range is the 95% confidence
+interval of the completion date; a wide range means the history is too short
+or too noisy for a reliable forecast. Forecasts need at least 3 snapshots.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if model != "best" && !slices.Contains(domain.ForecastModels, domain.ForecastModel(model)) {
+				log.Fatalf("unknown forecast model %q, expected best, linear or logistic", model)
+			}
+
+			cfg, err := config.Load(config.Path(configPath))
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			adoptions := make([]domain.Adoption, 0, len(cfg.QueryPairs))
+			forecasts := make([]*domain.Forecast, 0, len(cfg.QueryPairs))
+			for _, qp := range cfg.QueryPairs {
+				results, err := store.LoadQueryResults(qp.Name)
+				if err != nil {
+					log.Fatalf("error loading results for query %s: %v", qp.Name, err)
+				}
+
+				adoption, _ := domain.CalculateAdoption(qp.Name, results)
+				adoptions = append(adoptions, adoption)
+				forecasts = append(forecasts, forecast(model, domain.Snapshots(results)))
+			}
+
+			writeReport(output, "CRNT adoption report", adoptions, forecasts)
+		},
+	}
+	addOutputFlag(cmd, &output)
+	cmd.Flags().StringVar(&model, "model", "best", "Forecast model: linear, logistic, or best for the one that fits best")
+
+	return cmd
+}
+
+// adoptionOutput is the adoption of a query pair as written with --output
+// json; ratios are fractions between 0 and 1 rather than formatted
+// percentages.
+type adoptionOutput struct {
+	Query              string          `json:"query"`
+	Since              *time.Time      `json:"since,omitempty"`
+	Latest             *time.Time      `json:"latest,omitempty"`
+	Snapshots          int             `json:"snapshots"`
+	OldResults         int             `json:"oldResults"`
+	CrntResults        int             `json:"crntResults"`
+	Conversion         float64         `json:"conversion"`
+	DeltaSinceFirst    float64         `json:"deltaSinceFirst"`
+	DeltaSincePrevious float64         `json:"deltaSincePrevious"`
+	OldRemoved         int             `json:"oldRemoved"`
+	CrntAdded          int             `json:"crntAdded"`
+	Forecast           *forecastOutput `json:"forecast,omitempty"`
+}
+
+// forecastOutput is the forecast of a query pair as written with --output
+// json; dates are omitted if they aren't within the forecast horizon.
+type forecastOutput struct {
+	Model      domain.ForecastModel `json:"model"`
+	Done       bool                 `json:"done"`
+	Completion *time.Time           `json:"completion,omitempty"`
+	Earliest   *time.Time           `json:"earliest,omitempty"`
+	Latest     *time.Time           `json:"latest,omitempty"`
+}
+
+// forecast fits the model to the snapshots, or every model for best, and
+// returns the best fit; nil if there are too few snapshots.
+func forecast(model string, snapshots []domain.Snapshot) *domain.Forecast {
+	var f domain.Forecast
+	var ok bool
+	if model == "best" {
+		f, ok = domain.BestForecast(snapshots)
+	} else {
+		f, ok = domain.CalculateForecast(domain.ForecastModel(model), snapshots)
+	}
+
+	if !ok {
+		return nil
+	}
+	return &f
+}
+
+func writeReport(format outputFormat, title string, adoptions []domain.Adoption, forecasts []*domain.Forecast) {
+	t := table.NewWriter()
+	t.SetTitle(title)
+	t.AppendHeader(table.Row{"Query", "Since", "Snapshots", "Old count", "CRNT count", "Conversion", "Δ first", "Δ previous", "Old removed", "CRNT added", "Done by", "95% range", "Model"})
+
+	data := make([]adoptionOutput, len(adoptions))
+	for i, a := range adoptions {
+		data[i] = adoptionOutput{Query: a.QueryName}
+		if a.Snapshots == 0 {
+			t.AppendRow(table.Row{a.QueryName, "no results"})
+			continue
+		}
+
+		data[i] = adoptionOutput{
+			Query:              a.QueryName,
+			Since:              &a.First.Timestamp,
+			Latest:             &a.Latest.Timestamp,
+			Snapshots:          a.Snapshots,
+			OldResults:         a.Latest.OldResults,
+			CrntResults:        a.Latest.CrntResults,
+			Conversion:         a.Conversion(),
+			DeltaSinceFirst:    a.DeltaSinceFirst(),
+			DeltaSincePrevious: a.DeltaSincePrevious(),
+			OldRemoved:         a.OldRemoved(),
+			CrntAdded:          a.CrntAdded(),
+		}
+
+		doneBy, doneRange, model := "not enough data", "", ""
+		if f := forecasts[i]; f != nil {
+			data[i].Forecast = &forecastOutput{
+				Model:      f.Model,
+				Done:       f.Done,
+				Completion: optionalTime(f.Completion),
+				Earliest:   optionalTime(f.Earliest),
+				Latest:     optionalTime(f.Latest),
+			}
+			doneBy, doneRange, model = formatForecast(*f)
+		}
+
+		t.AppendRow(table.Row{
+			a.QueryName,
+			a.First.Timestamp.Format("2006-01-02"),
+			a.Snapshots,
+			a.Latest.OldResults,
+			a.Latest.CrntResults,
+			fmt.Sprintf("%.1f%%", a.Conversion()*100),
+			formatPointDelta(a.DeltaSinceFirst()),
+			formatPointDelta(a.DeltaSincePrevious()),
+			a.OldRemoved(),
+			a.CrntAdded(),
+			doneBy,
+			doneRange,
+			model,
+		})
+	}
+
+	format.render(t, data)
+}
+
+// formatForecast formats the completion date, its range and the model of a
+// forecast for the report table.
+func formatForecast(f domain.Forecast) (doneBy string, doneRange string, model string) {
+	if f.Done {
+		return "done", "", ""
+	}
+
+	formatDate := func(t time.Time) string {
+		if t.IsZero() {
+			return "?"
+		}
+		return t.Format(time.DateOnly)
+	}
+
+	doneBy = formatDate(f.Completion)
+	if f.Completion.IsZero() {
+		doneBy = "not in sight"
+	}
+	return doneBy, formatDate(f.Earliest) + " – " + formatDate(f.Latest), string(f.Model)
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// formatPointDelta formats a change in ratio as percentage points.
+func formatPointDelta(delta float64) string {
+	return fmt.Sprintf("%+.1fpp", delta*100)
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fwielstra/crntmetrics/storage"
+	"github.com/spf13/cobra"
+)
+
+// NewResetCmd creates the reset command, which deletes all stored data after
+// making a backup.
+func NewResetCmd() *cobra.Command {
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:   "reset",
+		Short: "Deletes all stored data, after making a backup",
+		Long: `Deletes all results, runs, projects and matches, to start over with an empty
+database. A timestamped backup is made first: for SQLite a copy of the
+database file next to it, for PostgreSQL a schema the tables are moved to.
+
+The database is never reset otherwise. Asks for confirmation unless --yes is
+given.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			database := describeDatabase(storage.DSN(databaseDSN))
+			if !yes && !confirm(os.Stdin, fmt.Sprintf("This deletes all data in %s. Type \"reset\" to continue: ", database)) {
+				log.Fatal("reset cancelled")
+			}
+
+			backup, err := store.Reset()
+			if err != nil {
+				log.Fatal(err)
+			}
+			log.Printf("backed up %s to %s", database, backup)
+
+			if _, err := store.Migrate(); err != nil {
+				log.Fatalf("error migrating database: %v", err)
+			}
+			log.Printf("reset %s", database)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Reset without asking for confirmation")
+
+	return cmd
+}
+
+// confirm asks the user to type "reset"; anything else, including no input
+// at all, cancels.
+func confirm(in io.Reader, prompt string) bool {
+	fmt.Fprint(os.Stderr, prompt)
+
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	return strings.TrimSpace(answer) == "reset"
+}
+
+// describeDatabase returns the database for messages: the absolute path of a
+// SQLite file, or a PostgreSQL URL without its password.
+func describeDatabase(dsn string) string {
+	if storage.IsPostgres(dsn) {
+		if u, err := url.Parse(dsn); err == nil {
+			return u.Redacted()
+		}
+		return "the PostgreSQL database"
+	}
+
+	if path, err := filepath.Abs(dsn); err == nil {
+		return path
+	}
+	return dsn
+}
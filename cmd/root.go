@@ -1,15 +1,38 @@
 package cmd
 
 import (
-	"database/sql"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 
+	"github.com/fwielstra/crntmetrics/config"
+	"github.com/fwielstra/crntmetrics/domain"
+	"github.com/fwielstra/crntmetrics/storage"
 	"github.com/spf13/cobra"
 )
 
+// path to the query pair config file, see config.Path for how it's resolved.
+var configPath string
+
+// the database to use, see storage.DSN for how it's resolved.
+var databaseDSN string
+
+// store is opened before any command runs, from the --db flag.
+var store domain.Storage
+
+// commands with this annotation get a store whose schema isn't brought up to
+// date first, e.g. to inspect which migrations are pending.
+const skipMigrateAnnotation = "crntmetrics/skip-migrate"
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
-func Execute(db *sql.DB) {
+func Execute() {
 
 	// rootCmd represents the base command when called without any subcommands
 	var rootCmd = &cobra.Command{
@@ -19,6 +42,14 @@ func Execute(db *sql.DB) {
 instance in pairs, to track usage of code over time. Useful to generate
 analytics and reports on e.g. the adoption of the CRNT Design System.
 `,
+		Version: toolVersion(),
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			var err error
+			_, skipMigrate := cmd.Annotations[skipMigrateAnnotation]
+			if store, err = openStore(storage.DSN(databaseDSN), !skipMigrate); err != nil {
+				log.Fatal(err)
+			}
+		},
 		// Uncomment the following line if your bare application
 		// has an action associated with it:
 		// Run: func(cmd *cobra.Command, args []string) { },
@@ -26,17 +57,67 @@ analytics and reports on e.g. the adoption of the CRNT Design System.
 
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 	rootCmd.Flags().BoolP("verbose", "v", false, "Enable verbose logging, including API calls")
+	rootCmd.PersistentFlags().StringVarP(&configPath, "config", "c", "", fmt.Sprintf("query pair config file (default is $%s or %s)", config.EnvVar, config.DefaultPath))
+	rootCmd.PersistentFlags().StringVar(&databaseDSN, "db", "", fmt.Sprintf("database, the path of a SQLite file, or a postgres:// URL or key=value connection string (default is $%s or %s)", storage.EnvVar, storage.DefaultPath))
+
+	rootCmd.AddCommand(NewUpdateCmd())
+	rootCmd.AddCommand(NewGenerateChartCmd())
+	rootCmd.AddCommand(NewReportCmd())
+	rootCmd.AddCommand(NewMigrateCmd())
+	rootCmd.AddCommand(NewProjectsCmd())
+	rootCmd.AddCommand(NewRunsCmd())
+	rootCmd.AddCommand(NewWorklistCmd())
+	rootCmd.AddCommand(NewServeCmd())
+	rootCmd.AddCommand(NewBackfillCmd())
+	rootCmd.AddCommand(NewQueriesCmd())
+	rootCmd.AddCommand(NewResetCmd())
+	rootCmd.AddCommand(NewExportCmd())
+	rootCmd.AddCommand(NewImportCmd())
 
-	rootCmd.AddCommand(NewUpdateCmd(db))
-	rootCmd.AddCommand(NewGenerateChartCmd(db))
-	rootCmd.AddCommand(serveCmd)
+	// cancel the context on ctrl+c / SIGTERM so long running commands can stop cleanly.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	err := rootCmd.Execute()
+	err := rootCmd.ExecuteContext(ctx)
+	if store != nil {
+		store.Close()
+	}
 	if err != nil {
 		os.Exit(1)
 	}
 }
 
+// openStore opens the database and, if migrate is set, brings its schema up
+// to date. A SQLite database that doesn't exist yet is created, but never
+// replaced.
+func openStore(dsn string, migrate bool) (domain.Storage, error) {
+	if !storage.IsPostgres(dsn) {
+		if _, err := os.Stat(dsn); errors.Is(err, fs.ErrNotExist) {
+			// make it obvious when running from the wrong directory, rather
+			// than looking like all data was lost.
+			path, _ := filepath.Abs(dsn)
+			log.Printf("no database at %s yet, creating a new one; use --db or $%s to use an existing database", path, storage.EnvVar)
+		}
+	}
+
+	s, err := storage.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if !migrate {
+		return s, nil
+	}
+
+	// bring the schema up to date; this is a no-op if there are no new migrations.
+	if _, err := s.Migrate(); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("error migrating database: %w", err)
+	}
+
+	return s, nil
+}
+
 func init() {
 	// Here you will define your flags and configuration settings.
 	// Cobra supports persistent flags, which, if defined here,
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/fwielstra/crntmetrics/domain"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+)
+
+// NewRunsCmd creates the runs command and its subcommands.
+func NewRunsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "runs",
+		Short: "Inspects previous update runs",
+		Long: `Every update is recorded as a run, with its status, errors, the Gitlab
+instance it queried, the hash of the config file and the version of this tool.
+Use this to find out whether a dip in a chart was caused by a partially failed
+run or a config change.`,
+	}
+
+	var listOutput, showOutput outputFormat
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "Lists the most recent runs",
+		Run: func(cmd *cobra.Command, args []string) {
+			limit, _ := cmd.Flags().GetInt("limit")
+
+			runs, err := store.LoadRuns(limit)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			writeRuns(listOutput, "Update runs", runs)
+		},
+	}
+	list.Flags().IntP("limit", "n", 20, "Number of runs to list")
+	addOutputFlag(list, &listOutput)
+
+	show := &cobra.Command{
+		Use:   "show <id>",
+		Short: "Shows the details, errors and results of a run",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				log.Fatalf("invalid run ID %q", args[0])
+			}
+
+			run, err := store.LoadRun(id)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			results, err := store.LoadRunResults(id)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			projectNames, err := store.LoadProjectNames()
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			if showOutput == outputJSON {
+				writeJSON(runOutput{Run: run, Results: results})
+				return
+			}
+
+			writeRun(showOutput, run)
+			writeTable(showOutput, fmt.Sprintf("Results of run %d", run.ID), results, projectNames)
+		},
+	}
+	addOutputFlag(show, &showOutput)
+
+	cmd.AddCommand(list, show)
+
+	return cmd
+}
+
+// runOutput is a run with its results, as written by runs show --output json.
+type runOutput struct {
+	domain.Run
+	Results []domain.ResultRow `json:"results"`
+}
+
+func writeRuns(format outputFormat, title string, runs []domain.Run) {
+	t := table.NewWriter()
+	t.SetTitle(title)
+	t.AppendHeader(table.Row{"ID", "Started", "Duration", "Status", "Errors", "Config hash", "Version"})
+
+	for _, run := range runs {
+		t.AppendRow(table.Row{run.ID, run.StartedAt.Format("2006-01-02 15:04:05"), runDuration(run), run.Status, run.ErrorCount, shortHash(run.ConfigHash), run.ToolVersion})
+	}
+
+	// an empty list rather than null in JSON.
+	format.render(t, append([]domain.Run{}, runs...))
+}
+
+func writeRun(format outputFormat, run domain.Run) {
+	t := table.NewWriter()
+	t.SetTitle(fmt.Sprintf("Run %d", run.ID))
+
+	finished := "-"
+	if !run.FinishedAt.IsZero() {
+		finished = run.FinishedAt.Format("2006-01-02 15:04:05")
+	}
+
+	t.AppendRows([]table.Row{
+		{"Started", run.StartedAt.Format("2006-01-02 15:04:05")},
+		{"Finished", finished},
+		{"Duration", runDuration(run)},
+		{"Status", run.Status},
+		{"Gitlab", run.GitlabURL},
+		{"Config hash", run.ConfigHash},
+		{"Version", run.ToolVersion},
+		{"Details", run.Details},
+		{"Errors", run.ErrorCount},
+	})
+
+	for _, err := range run.Errors {
+		t.AppendRow(table.Row{"", err})
+	}
+
+	format.render(t, run)
+}
+
+func runDuration(run domain.Run) string {
+	if run.FinishedAt.IsZero() {
+		return "-"
+	}
+	return run.FinishedAt.Sub(run.StartedAt).Round(time.Millisecond).String()
+}
+
+// shortHash abbreviates a hash like git does; the full hash is in runs show.
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
@@ -4,30 +4,129 @@ Copyright © 2025 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
 
+	"github.com/fwielstra/crntmetrics/config"
+	"github.com/fwielstra/crntmetrics/domain"
+	"github.com/fwielstra/crntmetrics/schedule"
+	"github.com/fwielstra/crntmetrics/server"
 	"github.com/spf13/cobra"
 )
 
-// serveCmd represents the serve command
-var serveCmd = &cobra.Command{
-	Use:   "serve",
-	Short: "Starts a HTTP server for displaying chart data",
-	Long:  ``,
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("serve called")
-	},
+// how long to wait for open requests when shutting down.
+const shutdownTimeout = 10 * time.Second
+
+// NewServeCmd creates the serve command, which serves the charts over HTTP.
+func NewServeCmd() *cobra.Command {
+	var opts updateOptions
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Starts a HTTP server for displaying chart data",
+		Long: `Starts a HTTP server with a dashboard rendering the stored results. The
+index page lists every query, and each query has its own chart page at
+/queries/<name>.
+
+With --schedule, the server also runs updates itself, so no separate cron job
+is needed. The schedule is an interval like 6h, or a cron expression like
+"0 6 * * 1-5" or @daily. The config file is reloaded for every update, and the
+update flags (--backend, --details, --rate etc.) apply to every update. After
+a restart, the next update is planned relative to the last run in the
+database. Updates never overlap, and ctrl+c / SIGTERM stops a running update
+cleanly before exiting.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			port, _ := cmd.Flags().GetInt("port")
+			spec, _ := cmd.Flags().GetString("schedule")
+			jitter, _ := cmd.Flags().GetDuration("jitter")
+
+			ctx := cmd.Context()
+			var wg sync.WaitGroup
+
+			var scheduler *schedule.Scheduler
+			if spec != "" {
+				var err error
+				if scheduler, err = newUpdateScheduler(store, spec, jitter, opts); err != nil {
+					log.Fatal(err)
+				}
+
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					scheduler.Run(ctx)
+				}()
+			}
+
+			srv := &http.Server{
+				Addr:    fmt.Sprintf(":%d", port),
+				Handler: server.New(store, scheduler),
+			}
+
+			go func() {
+				<-ctx.Done()
+				log.Print("shutting down")
+
+				shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+				defer cancel()
+				if err := srv.Shutdown(shutdownCtx); err != nil {
+					log.Print(err)
+				}
+			}()
+
+			log.Printf("serving dashboard at http://localhost%s", srv.Addr)
+			if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal(err)
+			}
+
+			// wait for a running update to store its results.
+			wg.Wait()
+		},
+	}
+
+	cmd.Flags().IntP("port", "p", 8080, "HTTP port to serve at")
+	cmd.Flags().String("schedule", "", `Run updates on a schedule: an interval like 6h, or a cron expression like "0 6 * * 1-5"`)
+	cmd.Flags().Duration("jitter", 5*time.Minute, "Delay every scheduled update by a random duration up to this")
+	addUpdateFlags(cmd.Flags(), &opts)
+
+	return cmd
 }
 
-func init() {
-	// Here you will define your flags and configuration settings.
+// newUpdateScheduler creates a scheduler running updates, planning the first
+// update relative to the last update run in the database; backfills don't
+// count, they only fill in the past.
+func newUpdateScheduler(store domain.Storage, spec string, jitter time.Duration, opts updateOptions) (*schedule.Scheduler, error) {
+	s, err := schedule.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	// fail at startup rather than at the first update if the config is invalid.
+	if _, err := config.Load(config.Path(configPath)); err != nil {
+		return nil, err
+	}
+
+	var last time.Time
+	run, err := store.LoadLatestUpdateRun()
+	if err != nil && !errors.Is(err, domain.ErrRunNotFound) {
+		return nil, err
+	}
+	if err == nil {
+		last = run.StartedAt
+	}
 
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// serveCmd.PersistentFlags().String("foo", "", "A help for foo")
+	return schedule.New(s, jitter, last, func(ctx context.Context) error {
+		// reload the config so changes apply without a restart.
+		cfg, err := config.Load(config.Path(configPath))
+		if err != nil {
+			return err
+		}
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// serveCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
-	serveCmd.Flags().IntP("port", "p", 8080, "HTTP port to serve at")
+		_, err = updateData(ctx, store, cfg, opts)
+		return err
+	}), nil
 }
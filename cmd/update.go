@@ -5,177 +5,310 @@ package cmd
 
 import (
 	"cmp"
-	"database/sql"
+	"context"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/fwielstra/crntmetrics/config"
 	"github.com/fwielstra/crntmetrics/domain"
 	"github.com/fwielstra/crntmetrics/glclient"
-	"github.com/fwielstra/crntmetrics/sqlite"
+	"github.com/fwielstra/crntmetrics/localsearch"
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/spf13/cobra"
-
-	gitlab "gitlab.com/gitlab-org/api/client-go"
+	"github.com/spf13/pflag"
 )
 
-// if true, only runs the search queries and prints the results, does not persits the data
-var dontPersist bool
+// updateOptions are the flags of an update, shared by the update command and
+// the scheduled updates of the serve command.
+type updateOptions struct {
+	// if true, only runs the search queries and prints the results, does not persist the data
+	dontPersist bool
+	// maximum duration of an update run, 0 means no timeout.
+	timeout time.Duration
+	// number of queries to run simultaneously.
+	workers int
+	// search rate limit in requests per second and burst size, see
+	// defaultSearchRate.
+	rate  float64
+	burst int
+	// retry policy for failed search requests.
+	retry glclient.RetryPolicy
+	// if true, fetches and stores every match of the old queries for the worklist.
+	details bool
+	// the search backend to use, gitlab or local, and for local the clones to
+	// search in, as projectId=path.
+	backend string
+	repos   []string
+}
+
+// addUpdateFlags adds the flags that configure how an update searches.
+func addUpdateFlags(flags *pflag.FlagSet, opts *updateOptions) {
+	opts.retry = glclient.DefaultRetryPolicy
+
+	flags.DurationVar(&opts.timeout, "timeout", 0, "Maximum duration of an update, e.g. 5m; 0 means no timeout")
+	flags.IntVarP(&opts.workers, "workers", "w", 5, "Number of queries to run simultaneously")
+	flags.Float64Var(&opts.rate, "rate", defaultSearchRate, "Maximum search requests per second; 0 means no limit")
+	flags.IntVar(&opts.burst, "burst", defaultSearchBurst, "Number of search requests allowed in a burst before --rate applies")
+	flags.IntVar(&opts.retry.MaxRetries, "retries", opts.retry.MaxRetries, "Number of times to retry a search that was rate limited or failed with a server error")
+	flags.DurationVar(&opts.retry.MaxDelay, "retry-max-delay", opts.retry.MaxDelay, "Maximum delay between retries")
+	flags.BoolVar(&opts.details, "details", false, "Fetch and store every file matching the old queries, for the worklist command")
+	flags.StringVar(&opts.backend, "backend", "gitlab", "Search backend: gitlab for Gitlab's advanced search, or local to scan local clones given with --repo")
+	flags.StringArrayVar(&opts.repos, "repo", nil, "Local clone of a project for the local backend, as projectId=path; can be repeated")
+}
 
 // updateCmd represents the update command
-func NewUpdateCmd(db *sql.DB) *cobra.Command {
+func NewUpdateCmd() *cobra.Command {
+	var opts updateOptions
+	var output outputFormat
+
 	cmd := &cobra.Command{
 		Use:   "update",
 		Short: "Runs the queries and adds them to the database",
-		Long:  ``,
+		Long: `Runs all configured query pairs against Gitlab and stores the results.
+With --backend local, the queries run against local clones instead, given
+with --repo projectId=path, which works without network access.
+
+If a query fails, the results of the other queries are still stored, and the
+failed queries are reported at the end. Use --timeout to limit how long a run
+can take; ctrl+c stops a run cleanly.`,
 		Run: func(cmd *cobra.Command, args []string) {
-			updateData(db)
+			cfg, err := config.Load(config.Path(configPath))
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			resultRows, err := updateData(cmd.Context(), store, cfg, opts)
+
+			projectNames, loadErr := store.LoadProjectNames()
+			if loadErr != nil {
+				log.Fatalf("error loading project names: %v", loadErr)
+			}
+
+			writeTable(output, fmt.Sprintf("Queried results at %s", time.Now().Format(time.DateTime)), resultRows, projectNames)
+
+			if err != nil {
+				log.Fatal(err)
+			}
 		},
 	}
 
-	cmd.PersistentFlags().BoolVar(&dontPersist, "dontPersist", false, "Run queries but do not persist the results in the database")
+	cmd.PersistentFlags().BoolVar(&opts.dontPersist, "dontPersist", false, "Run queries but do not persist the results in the database")
+	addUpdateFlags(cmd.Flags(), &opts)
+	addOutputFlag(cmd, &output)
 
 	return cmd
 }
 
-// the set of queries to execute if update is true.
-var queryPairs = []domain.QueryPair{
-	{
-		Name:      "primary-button-web",
-		ProjectID: 62, // sitecore plus
-		Old:       `class=\"btn btn-primary extension:html`,
-		Crnt:      `("crnt-button" | "crnt-button-alt") variant=\"primary\" extension:html`,
-	},
-	// Note that button searches specifically look for react-native-paper buttons.
-	{
-		Name:      "primary-button-app",
-		ProjectID: 3202, // apps
-		Old:       `<Button mode=\"contained\" extension:tsx`,
-		Crnt:      `<Button variant=\"primary\" extension:tsx`,
-	},
-	{
-		Name:      "secondary-button-web",
-		ProjectID: 62,                                           // sitecore plus
-		Old:       `class=\""btn btn-secondary" extension:html`, // note that there is one use case where the button type is dynamic
-		Crnt:      `("crnt-button" | "crnt-button-alt") variant=\"secondary\" extension:html`,
-	},
-	{
-		Name:      "secondary-button-app",
-		ProjectID: 3202, // apps
-		Old:       `<Button mode=\"outlined\" extension:tsx`,
-		Crnt:      `Button variant=\"secondary\" extension:tsx`,
-	},
-	{
-		Name:      "tertiary-button",
-		ProjectID: 62, // sitecore plus
-		Old:       `class=\""btn btn-link" extension:html`,
-		Crnt:      `("crnt-button" | "crnt-button-alt") variant=\"tertiary\" extension:html`,
-	},
-	{
-		Name:      "tertiary-button-app",
-		ProjectID: 3202, // apps
-		Old:       `<Button mode=\"text\" extension:tsx`,
-		Crnt:      `Button variant=\"tertiary\" extension:tsx`,
-	},
-	{
-		Name:      "icon-web",
-		ProjectID: 62, // sitecore plus
-		Old:       `"fa-icon" extension:html`,
-		Crnt:      `"<crnt-icon" -"crnt-icon-button" extension:html`,
-	},
-	// This demonstrates the limitations; given they have the same name and
-	// mostly the same params, there's no way to discern between theme and crnt
-	// icons. Doing a loose query for the import has a lot of false positives,
-	// but an exact query won't work due to there rarely being a single import
-	// from that library.
-	// Queries for the app will also be tricky as everything is wrapped in their custom components.
-	{
-		Name:      "icon-apps",
-		ProjectID: 3202, // apps
-		Old:       `"import { Icon } from \"@essent/themes\"" extension:tsx`,
-		Crnt:      `"import { Icon } from \"@essent/crnt-react-native\"" extension:tsx`,
-	},
-}
+// updateData runs all query pairs and stores the results, recording the
+// update as a run. Results of successful queries are stored and returned even
+// if others failed; the returned error lists the queries that failed.
+func updateData(ctx context.Context, store domain.Storage, cfg *config.Config, opts updateOptions) ([]domain.ResultRow, error) {
+	queryPairs := cfg.QueryPairs
 
-// custom logger to allow for custom date/time format
-// see https://stackoverflow.com/questions/26152993/go-logger-to-print-timestamp
-type writer struct {
-	io.Writer
-	timeFormat string
-}
+	if opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+	}
+
+	search, source, err := newSearcher(opts)
+	if err != nil {
+		return nil, err
+	}
 
-func (w writer) Write(b []byte) (n int, err error) {
-	return w.Writer.Write(append([]byte(time.Now().Format(w.timeFormat)), b...))
+	// use one timestamp for all results
+	now := time.Now()
+
+	run := &domain.Run{
+		StartedAt:   now,
+		GitlabURL:   source,
+		ConfigHash:  cfg.Hash,
+		ToolVersion: toolVersion(),
+		Details:     opts.details,
+		Status:      domain.RunStatusRunning,
+	}
+
+	if !opts.dontPersist {
+		if err := store.StartRun(run); err != nil {
+			return nil, err
+		}
+		log.Printf("started run %d", run.ID)
+	}
+
+	resultRows, matches, queryErrs := runQueries(ctx, search, queryPairs, now, opts)
+
+	if ctx.Err() != nil {
+		log.Printf("update stopped early: %v", context.Cause(ctx))
+	}
+
+	run.Finish(time.Now(), len(queryPairs), queryErrs)
+
+	if !opts.dontPersist {
+		for i := range resultRows {
+			resultRows[i].RunID = run.ID
+		}
+		for i := range matches {
+			matches[i].RunID = run.ID
+		}
+
+		err := store.SaveResults(resultRows)
+		if err == nil {
+			err = store.SaveMatches(matches)
+		}
+		if err == nil {
+			err = store.SaveQueryVersions(domain.QueryVersions(queryPairs, resultRows))
+		}
+
+		if err != nil {
+			run.Finish(time.Now(), len(queryPairs), append(queryErrs, fmt.Errorf("error saving results: %w", err)))
+			run.Status = domain.RunStatusFailed
+			if err := store.FinishRun(run); err != nil {
+				log.Print(err)
+			}
+			return nil, fmt.Errorf("error saving results: %w", err)
+		}
+
+		if err := store.FinishRun(run); err != nil {
+			return resultRows, err
+		}
+		log.Printf("finished run %d with status %s", run.ID, run.Status)
+	}
+
+	if len(queryErrs) > 0 {
+		return resultRows, fmt.Errorf("%d of %d queries failed:\n%w", len(queryErrs), len(queryPairs), errors.Join(queryErrs...))
+	}
+
+	return resultRows, nil
 }
 
-type gitlabLogger struct {
-	log *log.Logger
+// newSearcher creates the searcher for the --backend flag, and returns a
+// description of what it searches to record in the run.
+func newSearcher(opts updateOptions) (domain.Searcher, string, error) {
+	switch opts.backend {
+	case "gitlab":
+		search, err := newGitlabSearch(opts.rate, opts.burst, opts.retry)
+		if err != nil {
+			return nil, "", err
+		}
+
+		return search, search.Client.BaseURL().String(), nil
+	case "local":
+		repos, err := parseLocalRepos(opts.repos)
+		if err != nil {
+			return nil, "", err
+		}
+
+		return &localsearch.Searcher{Repositories: repos}, "local:" + strings.Join(opts.repos, ","), nil
+	}
+
+	return nil, "", fmt.Errorf("unknown search backend %q, expected gitlab or local", opts.backend)
 }
 
-func (c *gitlabLogger) Printf(format string, v ...interface{}) {
-	c.log.Printf(format, v...)
+// parseLocalRepos parses --repo flags of the form projectId=path.
+func parseLocalRepos(values []string) ([]localsearch.Repository, error) {
+	clones, err := parseClones(values)
+	if err != nil {
+		return nil, err
+	}
+
+	repos := make([]localsearch.Repository, len(clones))
+	for i, c := range clones {
+		repos[i] = localsearch.NewRepository(c.projectID, c.dir)
+	}
+
+	return repos, nil
 }
 
-// We could fetch a list of projects from gitlab but lazy.
-var projectNames = map[int]string{
-	62:   "Sitecore plus / Frontend",
-	3202: "mobile-apps / Mobile Monorepo",
+// clone is a local clone of a project given with --repo.
+type clone struct {
+	projectID int
+	dir       string
 }
 
-func updateData(db *sql.DB) {
-	privateToken, exists := os.LookupEnv("PRIVATE_TOKEN")
-	if !exists {
-		log.Fatal("GitLab access token not set in environment variable PRIVATE_TOKEN")
+// parseClones parses --repo flags of the form projectId=path, checking that
+// the paths are directories.
+func parseClones(values []string) ([]clone, error) {
+	if len(values) == 0 {
+		return nil, fmt.Errorf("at least one --repo projectId=path is required")
 	}
 
-	// create and configure Gitlab API client
-	options := []gitlab.ClientOptionFunc{}
-	options = append(options, gitlab.WithBaseURL("https://gitlab.essent.nl/api/v4"))
-	options = append(options, gitlab.WithCustomLogger(&gitlabLogger{log: log.New(&writer{os.Stdout, time.RFC3339Nano}, " [gitlab] ", 0)}))
+	clones := make([]clone, len(values))
+	for i, value := range values {
+		id, dir, found := strings.Cut(value, "=")
+		projectID, err := strconv.Atoi(id)
+		if !found || err != nil || dir == "" {
+			return nil, fmt.Errorf("invalid --repo %q, expected projectId=path", value)
+		}
 
-	client, err := gitlab.NewClient(privateToken, options...)
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("invalid --repo %q: %s is not a directory", value, dir)
+		}
 
-	if err != nil {
-		log.Fatalf("Failed to create gitlab client: %v", err)
+		clones[i] = clone{projectID: projectID, dir: dir}
 	}
 
-	search := &glclient.Search{
-		Client:  client,
-		Verbose: true,
-	}
+	return clones, nil
+}
 
-	// use one timestamp for all results
-	now := time.Now()
+// the outcome of running a single query pair; either rows and, with
+// --details, matches, or an error.
+type queryResult struct {
+	rows    []domain.ResultRow
+	matches []domain.Match
+	err     error
+}
 
-	worker := func(queryPairsChan <-chan domain.QueryPair, results chan<- domain.ResultRow, wg *sync.WaitGroup) {
+// runQueries runs the query pairs using a pool of workers. Errors are
+// collected per query pair instead of aborting the whole run. Once ctx is
+// done, the remaining query pairs are skipped and reported as failed.
+func runQueries(ctx context.Context, search domain.Searcher, queryPairs []domain.QueryPair, now time.Time, opts updateOptions) ([]domain.ResultRow, []domain.Match, []error) {
+	// each query pair results in a row per project it found matches in.
+	worker := func(queryPairsChan <-chan domain.QueryPair, results chan<- queryResult, wg *sync.WaitGroup) {
 		defer wg.Done()
 		for qp := range queryPairsChan {
+			if err := ctx.Err(); err != nil {
+				results <- queryResult{err: fmt.Errorf("query %s skipped: %w", qp.Name, err)}
+				continue
+			}
+
 			log.Printf("Running query %s...", qp.Name)
-			oldResults, err1 := search.CountCodeByProject(qp.Old, qp.ProjectID)
-			crntResults, err2 := search.CountCodeByProject(qp.Crnt, qp.ProjectID)
+
+			var oldResults map[int]int
+			var oldMatches []*domain.SearchResult
+			var err1 error
+			if opts.details {
+				// all matches are fetched anyway, so count those instead of
+				// searching twice; the run records that its counts came from
+				// the matches.
+				oldMatches, err1 = search.SearchCode(ctx, qp.Old, qp.Scope)
+				oldResults = domain.CountByProject(oldMatches)
+			} else {
+				oldResults, err1 = search.CountCode(ctx, qp.Old, qp.Scope)
+			}
+			crntResults, err2 := search.CountCode(ctx, qp.Crnt, qp.Scope)
 
 			if err := cmp.Or(err1, err2); err != nil {
-				log.Fatalf("error querying code %v", err)
+				results <- queryResult{err: fmt.Errorf("query %s: %w", qp.Name, err)}
+				continue
 			}
 
-			res := domain.ResultRow{
-				Timestamp:   now,
-				ProjectID:   qp.ProjectID,
-				QueryName:   qp.Name,
-				OldResults:  oldResults,
-				CrntResults: crntResults,
+			matches := make([]domain.Match, len(oldMatches))
+			for i, m := range oldMatches {
+				matches[i] = domain.Match{Timestamp: now, QueryName: qp.Name, SearchResult: *m}
 			}
 
-			results <- res
+			results <- queryResult{rows: qp.Results(now, oldResults, crntResults), matches: matches}
 		}
 	}
 
 	tasks := make(chan domain.QueryPair, 5)
-	results := make(chan domain.ResultRow, 5)
+	results := make(chan queryResult, 5)
 	var wg sync.WaitGroup
 
 	// configure how many workers and thus simultaneous queries can run; while
@@ -184,7 +317,9 @@ func updateData(db *sql.DB) {
 	// 1 worker:  0,25s user 0,39s system 35% cpu 1,811 total
 	// 3 workers: 0,26s user 0,40s system 55% cpu 1,199 total
 	// 5 workers: 0,25s user 0,38s system 73% cpu 0,871 total
-	for i := 0; i < 5; i++ {
+	// This is configurable with --workers; note that the search rate limit
+	// applies to all workers combined.
+	for i := 0; i < max(opts.workers, 1); i++ {
 		wg.Add(1)
 		go worker(tasks, results, &wg)
 	}
@@ -211,38 +346,45 @@ func updateData(db *sql.DB) {
 	// Go thingy; normally when converting one slice to another you know the
 	// length, but since we're converting a channel to a slice we don't have
 	// that information while ranging over it, so we can't use the index. We do
-	// know what the length of the results will be though. However, if we pass
+	// know the minimum length of the results though, one row per query pair
+	// for single project queries. However, if we pass
 	// len(queryPairs) as the 2nd argument to make(), then append to it, we'd
 	// get a slice that is len(queryPairs) of `nil` + len(queryPairs) of
 	// results. Using the three arg version of make omits that, it sets the
 	// length to 0 but the capacity to len(queryPairs).
 	resultRows := make([]domain.ResultRow, 0, len(queryPairs))
 
-	for res := range results {
-		resultRows = append(resultRows, res)
-	}
+	var matches []domain.Match
+	var errs []error
 
-	if !dontPersist {
-		if err := sqlite.SaveResults(db, resultRows); err != nil {
-			log.Fatalf("error saving results: %v", err)
+	for res := range results {
+		if res.err != nil {
+			errs = append(errs, res.err)
+			continue
 		}
+		resultRows = append(resultRows, res.rows...)
+		matches = append(matches, res.matches...)
 	}
 
-	writeTable(fmt.Sprintf("Queried results at %s", now), resultRows)
+	return resultRows, matches, errs
 }
 
-func writeTable(title string, results []domain.ResultRow) {
+// resultOutput is a result with its project name, as written with --output json.
+type resultOutput struct {
+	domain.ResultRow
+	ProjectName string `json:"projectName"`
+}
+
+func writeTable(format outputFormat, title string, results []domain.ResultRow, projectNames domain.ProjectNames) {
 	t := table.NewWriter()
-	t.SetOutputMirror(os.Stdout)
 	t.SetTitle(title)
 	t.AppendHeader(table.Row{"Timestamp", "Project", "Query", "Old count", "CRNT count"})
 
-	for _, row := range results {
-		projectName, exists := projectNames[row.ProjectID]
-		if !exists {
-			projectName = strconv.Itoa(row.ProjectID)
-		}
-		t.AppendRow(table.Row{row.Timestamp.Format("2006-01-02 15:04:05"), projectName, row.QueryName, row.OldResults, row.CrntResults})
+	data := make([]resultOutput, len(results))
+	for i, row := range results {
+		t.AppendRow(table.Row{row.Timestamp.Format("2006-01-02 15:04:05"), projectNames.Name(row.ProjectID), row.QueryName, row.OldResults, row.CrntResults})
+		data[i] = resultOutput{ResultRow: row, ProjectName: projectNames.Name(row.ProjectID)}
 	}
-	t.Render()
+
+	format.render(t, data)
 }
@@ -0,0 +1,47 @@
+package cmd
+
+import "runtime/debug"
+
+// Version is the version of the tool, set at build time with
+// -ldflags "-X github.com/fwielstra/crntmetrics/cmd.Version=v1.2.3".
+var Version = ""
+
+// toolVersion returns Version if set, or the module version / VCS revision Go
+// embedded in the binary otherwise.
+func toolVersion() string {
+	if Version != "" {
+		return Version
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+
+	if info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+
+	var revision, modified string
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value
+		}
+	}
+
+	if revision == "" {
+		return "devel"
+	}
+
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if modified == "true" {
+		revision += "-dirty"
+	}
+
+	return revision
+}
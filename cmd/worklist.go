@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/fwielstra/crntmetrics/config"
+	"github.com/fwielstra/crntmetrics/domain"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+)
+
+// NewWorklistCmd creates the worklist command, which lists the files that
+// still use the old component of a query pair.
+func NewWorklistCmd() *cobra.Command {
+	var output outputFormat
+
+	cmd := &cobra.Command{
+		Use:   "worklist [query...]",
+		Short: "Lists every file still using the old component, grouped by directory",
+		Long: `Lists every file matching the old query of a pair in the most recent update
+that ran with --details, grouped by project and directory, with links to the
+file in Gitlab. Without arguments, lists the worklist of every configured
+query pair.
+
+With --output json or csv, the matches of all queries are written as a single
+list, with the query name in every row.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			queries := args
+			if len(queries) == 0 {
+				cfg, err := config.Load(config.Path(configPath))
+				if err != nil {
+					log.Fatal(err)
+				}
+				for _, qp := range cfg.QueryPairs {
+					queries = append(queries, qp.Name)
+				}
+			}
+
+			projectNames, err := store.LoadProjectNames()
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			projectURLs, err := store.LoadProjectURLs()
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			var all []domain.Match
+			for _, query := range queries {
+				matches, err := store.LoadLatestMatches(query)
+				if err != nil {
+					log.Fatalf("error loading matches for query %s: %v", query, err)
+				}
+
+				if len(matches) == 0 {
+					log.Printf("%s: no matches; either no file uses the old component anymore, or update hasn't run with --details yet", query)
+					continue
+				}
+
+				// tables are easier to read per query, data is easier to process as one list.
+				if output == outputTable || output == outputMarkdown {
+					writeWorklist(output, query, matches, projectNames, projectURLs)
+				}
+				all = append(all, matches...)
+			}
+
+			if output == outputJSON || output == outputCSV {
+				writeMatches(output, all, projectNames, projectURLs)
+			}
+		},
+	}
+	addOutputFlag(cmd, &output)
+
+	return cmd
+}
+
+func writeWorklist(format outputFormat, query string, matches []domain.Match, projectNames domain.ProjectNames, projectURLs map[int]string) {
+	t := table.NewWriter()
+	t.SetTitle(fmt.Sprintf("%s: %d matches to migrate, as of %s", query, len(matches), matches[0].Timestamp.Format("2006-01-02 15:04:05")))
+	t.AppendHeader(table.Row{"Project", "Directory", "File", "Link"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, AutoMerge: true},
+		{Number: 2, AutoMerge: true},
+	})
+
+	// matches are sorted by project and path, so files in the same directory are adjacent.
+	for _, m := range matches {
+		t.AppendRow(table.Row{
+			projectNames.Name(m.ProjectID),
+			path.Dir(m.Path) + "/",
+			path.Base(m.Path),
+			blobURL(projectURLs[m.ProjectID], m.SearchResult),
+		})
+	}
+
+	format.render(t, matches)
+	if format == outputTable {
+		fmt.Println()
+	}
+}
+
+// matchOutput is a match with its project name and link, as written with
+// --output json.
+type matchOutput struct {
+	domain.Match
+	ProjectName string `json:"projectName"`
+	URL         string `json:"url"`
+}
+
+// writeMatches writes the matches of multiple queries as a single list.
+func writeMatches(format outputFormat, matches []domain.Match, projectNames domain.ProjectNames, projectURLs map[int]string) {
+	t := table.NewWriter()
+	t.AppendHeader(table.Row{"Timestamp", "Query", "Project", "Path", "Line", "Link"})
+
+	data := make([]matchOutput, len(matches))
+	for i, m := range matches {
+		data[i] = matchOutput{Match: m, ProjectName: projectNames.Name(m.ProjectID), URL: blobURL(projectURLs[m.ProjectID], m.SearchResult)}
+		t.AppendRow(table.Row{m.Timestamp.Format("2006-01-02 15:04:05"), m.QueryName, data[i].ProjectName, m.Path, m.StartLine, data[i].URL})
+	}
+
+	format.render(t, data)
+}
+
+// blobURL returns the link to the matching line of a file in Gitlab, or just
+// the file path if the project's URL is unknown (run projects sync).
+func blobURL(projectURL string, res domain.SearchResult) string {
+	if projectURL == "" {
+		return res.Path
+	}
+
+	segments := strings.Split(res.Path, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+
+	link := fmt.Sprintf("%s/-/blob/%s/%s", strings.TrimSuffix(projectURL, "/"), url.PathEscape(res.Ref), strings.Join(segments, "/"))
+	if res.StartLine > 0 {
+		link += fmt.Sprintf("#L%d", res.StartLine)
+	}
+	return link
+}
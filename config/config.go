@@ -0,0 +1,284 @@
+// Package config loads the query pairs that the update command runs from a
+// versioned YAML, JSON or TOML file, so adding a query does not require a
+// rebuild.
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/fwielstra/crntmetrics/domain"
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentVersion is the config file format version this build understands.
+const CurrentVersion = 1
+
+// EnvVar is the environment variable that can hold the config file path.
+const EnvVar = "CRNTMETRICS_CONFIG"
+
+// DefaultPath is used if neither a flag nor EnvVar specify a config file.
+const DefaultPath = "queries.yaml"
+
+// query names end up in URLs and file names, so keep them boring.
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Query is a single query pair as it appears in the config file. Exactly one
+// of ProjectID, Projects, Group or Instance sets where the pair searches.
+type Query struct {
+	Name      string `yaml:"name" json:"name" toml:"name"`
+	ProjectID int    `yaml:"projectId" json:"projectId" toml:"projectId"`
+	Projects  []int  `yaml:"projects" json:"projects" toml:"projects"`
+	Group     string `yaml:"group" json:"group" toml:"group"`
+	Instance  bool   `yaml:"instance" json:"instance" toml:"instance"`
+	Old       string `yaml:"old" json:"old" toml:"old"`
+	Crnt      string `yaml:"crnt" json:"crnt" toml:"crnt"`
+}
+
+// the keys allowed in a query entry, used to reject typos in YAML files.
+var queryKeys = []string{"name", "projectId", "projects", "group", "instance", "old", "crnt"}
+
+// Scope converts the query's target to a domain.Scope.
+func (q Query) Scope() domain.Scope {
+	switch {
+	case q.Instance:
+		return domain.Scope{Instance: true}
+	case q.Group != "":
+		return domain.Scope{Group: q.Group}
+	case q.ProjectID != 0:
+		return domain.Scope{ProjectIDs: []int{q.ProjectID}}
+	}
+	return domain.Scope{ProjectIDs: q.Projects}
+}
+
+type file struct {
+	Version int     `yaml:"version" json:"version" toml:"version"`
+	Queries []entry `yaml:"queries" json:"queries" toml:"queries"`
+}
+
+// entry wraps Query with its position in the source file for error messages.
+type entry struct {
+	Query
+	line int
+}
+
+func (e *entry) UnmarshalJSON(b []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	return dec.Decode(&e.Query)
+}
+
+func (e *entry) UnmarshalYAML(node *yaml.Node) error {
+	e.line = node.Line
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: query must be a mapping", node.Line)
+	}
+
+	// Node.Decode does not inherit KnownFields from the decoder, so check keys manually.
+	for i := 0; i < len(node.Content); i += 2 {
+		key := node.Content[i]
+		if !slices.Contains(queryKeys, key.Value) {
+			return fmt.Errorf("line %d: unknown field %q in query", key.Line, key.Value)
+		}
+	}
+
+	return node.Decode(&e.Query)
+}
+
+func (e *entry) location(i int) string {
+	loc := fmt.Sprintf("queries[%d]", i)
+	if e.line > 0 {
+		loc = fmt.Sprintf("%s (line %d)", loc, e.line)
+	}
+	if e.Name != "" {
+		loc = fmt.Sprintf("%s %q", loc, e.Name)
+	}
+	return loc
+}
+
+// Config is a loaded and validated config file.
+type Config struct {
+	Path    string
+	Version int
+	// Hash is the SHA-256 of the file contents, so runs can record which
+	// version of the config they used.
+	Hash       string
+	QueryPairs []domain.QueryPair
+}
+
+// Path returns the config file to load; an explicit flag value wins over the
+// environment, which wins over DefaultPath.
+func Path(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if env, ok := os.LookupEnv(EnvVar); ok && env != "" {
+		return env
+	}
+	return DefaultPath
+}
+
+// Load reads, parses and validates the config file at path. The format is
+// determined by the file extension; .yaml, .yml, .json and .toml are supported.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config.Load(): error reading config file: %w", err)
+	}
+
+	cfg, err := Parse(data, filepath.Ext(path))
+	if err != nil {
+		return nil, fmt.Errorf("config.Load(): invalid config file %s: %w", path, err)
+	}
+
+	cfg.Path = path
+	cfg.Hash = fmt.Sprintf("%x", sha256.Sum256(data))
+	return cfg, nil
+}
+
+// Parse parses and validates config file contents; ext is the file extension
+// including the leading dot.
+func Parse(data []byte, ext string) (*Config, error) {
+	var f file
+
+	switch strings.ToLower(ext) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&f); err != nil {
+			return nil, err
+		}
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&f); err != nil {
+			return nil, err
+		}
+	case ".toml":
+		md, err := toml.NewDecoder(bytes.NewReader(data)).Decode(&f)
+		if err != nil {
+			return nil, err
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return nil, fmt.Errorf("unknown field %q", undecoded[0].String())
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config file extension %q, use .yaml, .yml, .json or .toml", ext)
+	}
+
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+
+	pairs := make([]domain.QueryPair, len(f.Queries))
+	for i, e := range f.Queries {
+		pairs[i] = domain.QueryPair{
+			Name:  e.Name,
+			Scope: e.Scope(),
+			Old:   e.Old,
+			Crnt:  e.Crnt,
+		}
+	}
+
+	return &Config{
+		Version:    f.Version,
+		QueryPairs: pairs,
+	}, nil
+}
+
+// validate checks the whole file and reports every problem at once, rather
+// than making people fix their config one error at a time.
+func (f *file) validate() error {
+	var errs []error
+
+	switch {
+	case f.Version == 0:
+		errs = append(errs, fmt.Errorf("missing version, expected version: %d", CurrentVersion))
+	case f.Version != CurrentVersion:
+		errs = append(errs, fmt.Errorf("unsupported version %d, expected version: %d", f.Version, CurrentVersion))
+	}
+
+	if len(f.Queries) == 0 {
+		errs = append(errs, errors.New("no queries defined"))
+	}
+
+	seen := make(map[string]int, len(f.Queries))
+	for i, e := range f.Queries {
+		loc := e.location(i)
+
+		if e.Name == "" {
+			errs = append(errs, fmt.Errorf("%s: missing name", loc))
+		} else if !validName.MatchString(e.Name) {
+			errs = append(errs, fmt.Errorf("%s: name may only contain letters, digits, '.', '_' and '-'", loc))
+		}
+
+		if first, exists := seen[e.Name]; exists && e.Name != "" {
+			errs = append(errs, fmt.Errorf("%s: duplicate name, first defined at %s", loc, f.Queries[first].location(first)))
+		} else {
+			seen[e.Name] = i
+		}
+
+		errs = append(errs, e.validateScope(loc)...)
+		if strings.TrimSpace(e.Old) == "" {
+			errs = append(errs, fmt.Errorf("%s: missing old query", loc))
+		}
+		if strings.TrimSpace(e.Crnt) == "" {
+			errs = append(errs, fmt.Errorf("%s: missing crnt query", loc))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (e *entry) validateScope(loc string) []error {
+	targets := 0
+	if e.ProjectID != 0 {
+		targets++
+	}
+	if e.Projects != nil {
+		targets++
+	}
+	if e.Group != "" {
+		targets++
+	}
+	if e.Instance {
+		targets++
+	}
+
+	switch {
+	case targets == 0:
+		return []error{fmt.Errorf("%s: missing target, set one of projectId, projects, group or instance", loc)}
+	case targets > 1:
+		return []error{fmt.Errorf("%s: only one of projectId, projects, group or instance can be set", loc)}
+	}
+
+	var errs []error
+	if e.ProjectID < 0 {
+		errs = append(errs, fmt.Errorf("%s: invalid projectId %d", loc, e.ProjectID))
+	}
+
+	if e.Projects != nil && len(e.Projects) == 0 {
+		errs = append(errs, fmt.Errorf("%s: projects is empty", loc))
+	}
+
+	seen := make(map[int]bool, len(e.Projects))
+	for _, id := range e.Projects {
+		if id <= 0 {
+			errs = append(errs, fmt.Errorf("%s: invalid project ID %d in projects", loc, id))
+		} else if seen[id] {
+			errs = append(errs, fmt.Errorf("%s: duplicate project ID %d in projects", loc, id))
+		}
+		seen[id] = true
+	}
+
+	return errs
+}
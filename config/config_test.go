@@ -0,0 +1,158 @@
+package config_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/fwielstra/crntmetrics/config"
+)
+
+func TestLoadRepositoryConfig(t *testing.T) {
+	cfg, err := config.Load("../queries.yaml")
+	if err != nil {
+		t.Fatalf("expected repository config to be valid, got %v", err)
+	}
+
+	if len(cfg.QueryPairs) == 0 {
+		t.Errorf("expected query pairs to be loaded")
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	data := `{"version": 1, "queries": [{"name": "icon-web", "projectId": 62, "old": "\"fa-icon\"", "crnt": "\"<crnt-icon\""}]}`
+
+	cfg, err := config.Parse([]byte(data), ".json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := cfg.QueryPairs[0]; got.Name != "icon-web" || !slices.Equal(got.Scope.ProjectIDs, []int{62}) || got.Old != `"fa-icon"` {
+		t.Errorf("unexpected query pair %+v", got)
+	}
+}
+
+func TestParseTOML(t *testing.T) {
+	data := `version = 1
+
+[[queries]]
+name = "icon-web"
+projects = [62, 3202]
+old = '"fa-icon"'
+crnt = '"<crnt-icon"'
+`
+
+	cfg, err := config.Parse([]byte(data), ".toml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := cfg.QueryPairs[0]; got.Name != "icon-web" || !slices.Equal(got.Scope.ProjectIDs, []int{62, 3202}) || got.Old != `"fa-icon"` {
+		t.Errorf("unexpected query pair %+v", got)
+	}
+
+	_, err = config.Parse([]byte(data+"typo = 1\n"), ".toml")
+	if err == nil || !strings.Contains(err.Error(), "typo") {
+		t.Errorf("expected an error for an unknown field, got %v", err)
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	data := `version: 1
+queries:
+  - {name: projects, projects: [62, 3202], old: x, crnt: y}
+  - {name: group, group: frontend/web, old: x, crnt: y}
+  - {name: group-id, group: 12, old: x, crnt: y}
+  - {name: instance, instance: true, old: x, crnt: y}
+`
+
+	cfg, err := config.Parse([]byte(data), ".yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := cfg.QueryPairs[0].Scope.ProjectIDs; !slices.Equal(got, []int{62, 3202}) {
+		t.Errorf("expected projects 62 and 3202, got %v", got)
+	}
+	if got := cfg.QueryPairs[1].Scope.Group; got != "frontend/web" {
+		t.Errorf("expected group frontend/web, got %q", got)
+	}
+	if got := cfg.QueryPairs[2].Scope.Group; got != "12" {
+		t.Errorf("expected group 12, got %q", got)
+	}
+	if !cfg.QueryPairs[3].Scope.Instance {
+		t.Errorf("expected instance scope")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr []string
+	}{
+		{
+			name:    "missing version",
+			data:    "queries:\n  - {name: a, projectId: 1, old: x, crnt: y}\n",
+			wantErr: []string{"missing version"},
+		},
+		{
+			name:    "unsupported version",
+			data:    "version: 2\nqueries:\n  - {name: a, projectId: 1, old: x, crnt: y}\n",
+			wantErr: []string{"unsupported version 2"},
+		},
+		{
+			name: "duplicate names",
+			data: `version: 1
+queries:
+  - {name: a, projectId: 1, old: x, crnt: y}
+  - {name: b, projectId: 1, old: x, crnt: y}
+  - {name: a, projectId: 2, old: x, crnt: y}
+`,
+			wantErr: []string{`queries[2] (line 5) "a": duplicate name, first defined at queries[0] (line 3) "a"`},
+		},
+		{
+			name: "missing fields",
+			data: `version: 1
+queries:
+  - name: a
+`,
+			wantErr: []string{"missing target", "missing old query", "missing crnt query"},
+		},
+		{
+			name:    "multiple targets",
+			data:    "version: 1\nqueries:\n  - {name: a, projectId: 1, group: web, old: x, crnt: y}\n",
+			wantErr: []string{"only one of projectId, projects, group or instance"},
+		},
+		{
+			name:    "duplicate projects",
+			data:    "version: 1\nqueries:\n  - {name: a, projects: [1, 2, 1], old: x, crnt: y}\n",
+			wantErr: []string{"duplicate project ID 1"},
+		},
+		{
+			name:    "unknown field",
+			data:    "version: 1\nqueries:\n  - {name: a, project: 1, old: x, crnt: y}\n",
+			wantErr: []string{`line 3: unknown field "project"`},
+		},
+		{
+			name:    "invalid name",
+			data:    "version: 1\nqueries:\n  - {name: a b, projectId: 1, old: x, crnt: y}\n",
+			wantErr: []string{"name may only contain"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := config.Parse([]byte(tt.data), ".yaml")
+			if err == nil {
+				t.Fatalf("expected an error")
+			}
+
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected error to contain %q, got:\n%v", want, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package domain
+
+import (
+	"sort"
+	"time"
+)
+
+// Snapshot is the total of a query's results across all projects at a single
+// point in time, i.e. one update run.
+type Snapshot struct {
+	Timestamp   time.Time
+	OldResults  int
+	CrntResults int
+}
+
+// Conversion returns the share of CRNT usages, crnt / (old + crnt), as a
+// fraction between 0 and 1. Zero usages of either counts as no conversion.
+func (s Snapshot) Conversion() float64 {
+	total := s.OldResults + s.CrntResults
+	if total == 0 {
+		return 0
+	}
+	return float64(s.CrntResults) / float64(total)
+}
+
+// Snapshots sums the results per timestamp, ordered from oldest to newest.
+func Snapshots(results []ResultRow) []Snapshot {
+	byTimestamp := make(map[int64]*Snapshot)
+	for _, res := range results {
+		key := res.Timestamp.UnixMilli()
+		s, exists := byTimestamp[key]
+		if !exists {
+			s = &Snapshot{Timestamp: res.Timestamp}
+			byTimestamp[key] = s
+		}
+		s.OldResults += res.OldResults
+		s.CrntResults += res.CrntResults
+	}
+
+	snapshots := make([]Snapshot, 0, len(byTimestamp))
+	for _, s := range byTimestamp {
+		snapshots = append(snapshots, *s)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Timestamp.Before(snapshots[j].Timestamp)
+	})
+
+	return snapshots
+}
+
+// CombinedSnapshots sums the results of all queries per timestamp, ordered
+// from oldest to newest. A query without results at a timestamp, e.g. because
+// it failed in that run, counts with its latest snapshot before it, so a
+// single failed query doesn't show as a dip in the total.
+func CombinedSnapshots(results []ResultRow) []Snapshot {
+	byQuery := make(map[string][]ResultRow)
+	for _, res := range results {
+		byQuery[res.QueryName] = append(byQuery[res.QueryName], res)
+	}
+
+	perQuery := make([][]Snapshot, 0, len(byQuery))
+	for _, queryResults := range byQuery {
+		perQuery = append(perQuery, Snapshots(queryResults))
+	}
+
+	// all timestamps of any query, each query advancing to its latest
+	// snapshot at or before the timestamp.
+	timestamps := Snapshots(results)
+	positions := make([]int, len(perQuery))
+	combined := make([]Snapshot, len(timestamps))
+	for i, ts := range timestamps {
+		combined[i].Timestamp = ts.Timestamp
+		for q, snapshots := range perQuery {
+			for positions[q] < len(snapshots) && !snapshots[positions[q]].Timestamp.After(ts.Timestamp) {
+				positions[q]++
+			}
+			if positions[q] > 0 {
+				latest := snapshots[positions[q]-1]
+				combined[i].OldResults += latest.OldResults
+				combined[i].CrntResults += latest.CrntResults
+			}
+		}
+	}
+
+	return combined
+}
+
+// Adoption compares the first, previous and latest snapshots of a query pair.
+type Adoption struct {
+	QueryName string
+	Snapshots int
+	First     Snapshot
+	Previous  Snapshot
+	Latest    Snapshot
+}
+
+// CalculateAdoption calculates the adoption of a query pair from its results.
+// It returns false if there are no results. With a single snapshot, first,
+// previous and latest are all the same.
+func CalculateAdoption(queryName string, results []ResultRow) (Adoption, bool) {
+	snapshots := Snapshots(results)
+	if len(snapshots) == 0 {
+		return Adoption{QueryName: queryName}, false
+	}
+
+	previous := snapshots[0]
+	if len(snapshots) > 1 {
+		previous = snapshots[len(snapshots)-2]
+	}
+
+	return Adoption{
+		QueryName: queryName,
+		Snapshots: len(snapshots),
+		First:     snapshots[0],
+		Previous:  previous,
+		Latest:    snapshots[len(snapshots)-1],
+	}, true
+}
+
+// Conversion is the current conversion ratio.
+func (a Adoption) Conversion() float64 {
+	return a.Latest.Conversion()
+}
+
+// DeltaSinceFirst is the change in conversion ratio since the first snapshot.
+func (a Adoption) DeltaSinceFirst() float64 {
+	return a.Latest.Conversion() - a.First.Conversion()
+}
+
+// DeltaSincePrevious is the change in conversion ratio since the previous snapshot.
+func (a Adoption) DeltaSincePrevious() float64 {
+	return a.Latest.Conversion() - a.Previous.Conversion()
+}
+
+// OldRemoved is the number of old usages removed since the first snapshot;
+// negative if old usages were added.
+func (a Adoption) OldRemoved() int {
+	return a.First.OldResults - a.Latest.OldResults
+}
+
+// CrntAdded is the number of CRNT usages added since the first snapshot.
+func (a Adoption) CrntAdded() int {
+	return a.Latest.CrntResults - a.First.CrntResults
+}
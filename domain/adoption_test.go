@@ -0,0 +1,99 @@
+package domain_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/fwielstra/crntmetrics/domain"
+)
+
+func TestCalculateAdoption(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2025, 6, d, 12, 0, 0, 0, time.UTC)
+	}
+
+	// out of order, with the second snapshot spread over two projects.
+	results := []domain.ResultRow{
+		{Timestamp: day(3), ProjectID: 62, OldResults: 50, CrntResults: 50},
+		{Timestamp: day(1), ProjectID: 62, OldResults: 90, CrntResults: 10},
+		{Timestamp: day(2), ProjectID: 62, OldResults: 60, CrntResults: 20},
+		{Timestamp: day(2), ProjectID: 3202, OldResults: 20, CrntResults: 0},
+	}
+
+	a, ok := domain.CalculateAdoption("icon-web", results)
+	if !ok {
+		t.Fatalf("expected adoption to be calculated")
+	}
+
+	if a.Snapshots != 3 {
+		t.Errorf("expected 3 snapshots, got %d", a.Snapshots)
+	}
+
+	if a.Previous.OldResults != 80 || a.Previous.CrntResults != 20 {
+		t.Errorf("expected previous snapshot to sum projects, got %+v", a.Previous)
+	}
+
+	assertFloat(t, "conversion", a.Conversion(), 0.5)
+	assertFloat(t, "delta since first", a.DeltaSinceFirst(), 0.4)
+	assertFloat(t, "delta since previous", a.DeltaSincePrevious(), 0.3)
+
+	if a.OldRemoved() != 40 {
+		t.Errorf("expected 40 old usages removed, got %d", a.OldRemoved())
+	}
+
+	if a.CrntAdded() != 40 {
+		t.Errorf("expected 40 CRNT usages added, got %d", a.CrntAdded())
+	}
+}
+
+func TestCalculateAdoptionWithoutResults(t *testing.T) {
+	if _, ok := domain.CalculateAdoption("icon-web", nil); ok {
+		t.Errorf("expected no adoption without results")
+	}
+}
+
+func TestSnapshotConversionWithoutUsages(t *testing.T) {
+	if c := (domain.Snapshot{}).Conversion(); c != 0 {
+		t.Errorf("expected 0 conversion without usages, got %f", c)
+	}
+}
+
+func assertFloat(t *testing.T, name string, got float64, want float64) {
+	t.Helper()
+	if math.Abs(got-want) > 1e-9 {
+		t.Errorf("expected %s to be %f, got %f", name, want, got)
+	}
+}
+
+func TestCombinedSnapshots(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2025, 6, d, 12, 0, 0, 0, time.UTC)
+	}
+
+	// icon-web failed on the 2nd, button-web was added on the 3rd.
+	results := []domain.ResultRow{
+		{Timestamp: day(1), ProjectID: 62, QueryName: "icon-web", OldResults: 90, CrntResults: 10},
+		{Timestamp: day(1), ProjectID: 3202, QueryName: "icon-web", OldResults: 10, CrntResults: 0},
+		{Timestamp: day(2), ProjectID: 62, QueryName: "modal-web", OldResults: 5, CrntResults: 5},
+		{Timestamp: day(1), ProjectID: 62, QueryName: "modal-web", OldResults: 8, CrntResults: 2},
+		{Timestamp: day(3), ProjectID: 62, QueryName: "icon-web", OldResults: 60, CrntResults: 40},
+		{Timestamp: day(3), ProjectID: 62, QueryName: "button-web", OldResults: 30, CrntResults: 0},
+	}
+
+	want := []domain.Snapshot{
+		{Timestamp: day(1), OldResults: 108, CrntResults: 12},
+		{Timestamp: day(2), OldResults: 105, CrntResults: 15},
+		{Timestamp: day(3), OldResults: 95, CrntResults: 45},
+	}
+
+	got := domain.CombinedSnapshots(results)
+	if len(got) != len(want) {
+		t.Fatalf("expected %d snapshots, got %d: %+v", len(want), len(got), got)
+	}
+	for i := range want {
+		if !got[i].Timestamp.Equal(want[i].Timestamp) || got[i].OldResults != want[i].OldResults || got[i].CrntResults != want[i].CrntResults {
+			t.Errorf("snapshot %d: expected %+v, got %+v", i, want[i], got[i])
+		}
+	}
+}
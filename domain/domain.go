@@ -1,28 +1,181 @@
 package domain
 
-import "time"
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+)
 
 type Project struct {
-	ID   int
-	Name string
-	URL  string
+	ID        int    `json:"id"`
+	Name      string `json:"name,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+// ProjectNames maps project IDs to their names.
+type ProjectNames map[int]string
+
+// Name returns the name of the project, or its ID if the name is unknown.
+func (n ProjectNames) Name(projectID int) string {
+	if name, exists := n[projectID]; exists {
+		return name
+	}
+	return strconv.Itoa(projectID)
+}
+
+// Scope is where a query pair searches: either a list of projects, a group
+// including its subgroups, or the whole Gitlab instance.
+type Scope struct {
+	ProjectIDs []int `json:"projectIds,omitempty"`
+	// Group is the ID or full path of a Gitlab group.
+	Group    string `json:"group,omitempty"`
+	Instance bool   `json:"instance,omitempty"`
 }
 
 type QueryPair struct {
-	Name      string
-	ProjectID int
-	Old       string
-	Crnt      string
+	Name  string
+	Scope Scope
+	Old   string
+	Crnt  string
+}
+
+// Results combines the per-project counts of the old and CRNT queries into
+// result rows, sorted by project ID. Projects that were explicitly listed get
+// a row even without hits, so their series don't have gaps; for group and
+// instance searches, only projects with hits get one.
+func (qp QueryPair) Results(timestamp time.Time, old map[int]int, crnt map[int]int) []ResultRow {
+	projectIDs := make(map[int]bool)
+	for _, id := range qp.Scope.ProjectIDs {
+		projectIDs[id] = true
+	}
+	for id := range old {
+		projectIDs[id] = true
+	}
+	for id := range crnt {
+		projectIDs[id] = true
+	}
+
+	hash := qp.Hash()
+	results := make([]ResultRow, 0, len(projectIDs))
+	for id := range projectIDs {
+		results = append(results, ResultRow{
+			Timestamp:   timestamp,
+			ProjectID:   id,
+			QueryName:   qp.Name,
+			QueryHash:   hash,
+			OldResults:  old[id],
+			CrntResults: crnt[id],
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].ProjectID < results[j].ProjectID
+	})
+
+	return results
 }
 
+// SearchResult is a single file matching a search query.
 type SearchResult struct {
-	ProjectID int
+	ProjectID int    `json:"projectId"`
+	Path      string `json:"path"`
+	Ref       string `json:"ref"`
+	StartLine int    `json:"startLine"`
+	// Snippet is the part of the file around the match.
+	Snippet string `json:"snippet"`
+}
+
+// Searcher runs code search queries. Implemented by glclient for Gitlab's
+// advanced search and by localsearch for locally cloned repositories.
+type Searcher interface {
+	// CountCode counts the files matching the query per project in the scope.
+	CountCode(ctx context.Context, query string, scope Scope) (map[int]int, error)
+	// SearchCode returns every file matching the query in the scope.
+	SearchCode(ctx context.Context, query string, scope Scope) ([]*SearchResult, error)
+}
+
+// CountByProject counts the search results per project.
+func CountByProject(results []*SearchResult) map[int]int {
+	counts := make(map[int]int)
+	for _, res := range results {
+		counts[res.ProjectID]++
+	}
+	return counts
+}
+
+// Match is a search result of the old query of a pair, i.e. a file that still
+// has to be migrated.
+type Match struct {
+	RunID     int64     `json:"runId,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	QueryName string    `json:"query"`
+	SearchResult
 }
 
 type ResultRow struct {
-	Timestamp   time.Time
-	ProjectID   int
-	QueryName   string
-	OldResults  int
-	CrntResults int
+	// RunID is the update run that produced the result, 0 for results from
+	// before runs were recorded.
+	RunID       int64     `json:"runId,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+	ProjectID   int       `json:"projectId"`
+	QueryName   string    `json:"query"`
+	OldResults  int       `json:"oldResults"`
+	CrntResults int       `json:"crntResults"`
+	// CommitSHA is the commit the result was measured at for results
+	// backfilled from git history, empty otherwise.
+	CommitSHA string `json:"commitSha,omitempty"`
+	// QueryHash identifies the version of the query pair that produced the
+	// result, see QueryPair.Hash; empty for results from before versions were
+	// recorded.
+	QueryHash string `json:"queryHash,omitempty"`
+}
+
+type RunStatus string
+
+const (
+	RunStatusRunning   RunStatus = "running"
+	RunStatusSucceeded RunStatus = "succeeded"
+	// some queries failed, results of the others were stored.
+	RunStatusPartial RunStatus = "partial"
+	RunStatusFailed  RunStatus = "failed"
+)
+
+// Run is a single invocation of the update, which produces a result row per
+// query and project, all with the run's start time as timestamp.
+type Run struct {
+	ID          int64     `json:"id"`
+	StartedAt   time.Time `json:"startedAt"`
+	FinishedAt  time.Time `json:"finishedAt,omitzero"`
+	GitlabURL   string    `json:"gitlabUrl"`
+	ConfigHash  string    `json:"configHash"`
+	ToolVersion string    `json:"toolVersion"`
+	// Details is set if the run fetched every match of the old queries; its
+	// old counts are then the number of fetched matches rather than the
+	// total Gitlab reports.
+	Details    bool      `json:"details,omitempty"`
+	Status     RunStatus `json:"status"`
+	ErrorCount int       `json:"errorCount"`
+	Errors     []string  `json:"errors,omitempty"`
+}
+
+// Finish sets the finish time and derives the status from the errors of the
+// run's queries; total is the number of queries that ran.
+func (r *Run) Finish(finishedAt time.Time, total int, errs []error) {
+	r.FinishedAt = finishedAt
+	r.ErrorCount = len(errs)
+	r.Errors = make([]string, len(errs))
+	for i, err := range errs {
+		r.Errors[i] = err.Error()
+	}
+
+	switch {
+	case len(errs) == 0:
+		r.Status = RunStatusSucceeded
+	case len(errs) < total:
+		r.Status = RunStatusPartial
+	default:
+		r.Status = RunStatusFailed
+	}
 }
@@ -0,0 +1,39 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fwielstra/crntmetrics/domain"
+)
+
+func TestQueryPairResults(t *testing.T) {
+	now := time.Now()
+
+	t.Run("listed projects without hits get a row", func(t *testing.T) {
+		qp := domain.QueryPair{Name: "icon-web", Scope: domain.Scope{ProjectIDs: []int{62, 3202}}}
+		results := qp.Results(now, map[int]int{62: 4}, map[int]int{62: 1})
+
+		if len(results) != 2 {
+			t.Fatalf("expected 2 results, got %+v", results)
+		}
+		if results[1].ProjectID != 3202 || results[1].OldResults != 0 || results[1].CrntResults != 0 {
+			t.Errorf("expected empty row for project 3202, got %+v", results[1])
+		}
+	})
+
+	t.Run("group results only for projects with hits", func(t *testing.T) {
+		qp := domain.QueryPair{Name: "icon-web", Scope: domain.Scope{Group: "frontend"}}
+		results := qp.Results(now, map[int]int{7: 2}, map[int]int{3: 5})
+
+		if len(results) != 2 {
+			t.Fatalf("expected 2 results, got %+v", results)
+		}
+		if results[0].ProjectID != 3 || results[0].OldResults != 0 || results[0].CrntResults != 5 {
+			t.Errorf("unexpected first result %+v", results[0])
+		}
+		if results[1].ProjectID != 7 || results[1].OldResults != 2 || results[1].CrntResults != 0 {
+			t.Errorf("unexpected second result %+v", results[1])
+		}
+	})
+}
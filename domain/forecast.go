@@ -0,0 +1,232 @@
+package domain
+
+import (
+	"math"
+	"time"
+)
+
+// ForecastModel is the trend fitted to the conversion ratio of a query pair.
+type ForecastModel string
+
+const (
+	// ForecastLinear assumes a constant number of usages is converted per day.
+	ForecastLinear ForecastModel = "linear"
+	// ForecastLogistic assumes an S-curve: conversion starts slowly, speeds up,
+	// and slows down again for the last, hardest usages.
+	ForecastLogistic ForecastModel = "logistic"
+)
+
+// ForecastModels are all models, in the order they're reported.
+var ForecastModels = []ForecastModel{ForecastLinear, ForecastLogistic}
+
+// ForecastHorizon is how far ahead forecasts look; a completion further away
+// than this isn't estimated.
+const ForecastHorizon = 10 * 365 * 24 * time.Hour
+
+// minForecastSnapshots is the number of snapshots needed for a forecast; with
+// fewer, there's no way to tell how well the trend fits.
+const minForecastSnapshots = 3
+
+// Forecast is a trend fitted to the conversion ratio of a query pair, with the
+// projected date old usages reach zero.
+type Forecast struct {
+	Model ForecastModel
+	// Done is true if no old usages remain; there's no trend then.
+	Done bool
+	// Completion is when old usages are projected to reach zero, zero if the
+	// trend doesn't get there within the horizon.
+	Completion time.Time
+	// Earliest and Latest bound the completion with 95% confidence, zero if
+	// the bound isn't within the horizon.
+	Earliest time.Time
+	Latest   time.Time
+	// Error is the sum of squared differences between the trend and the
+	// snapshots' conversion ratios, to compare how well models fit.
+	Error float64
+
+	origin time.Time
+	fit    regression
+}
+
+// Conversion returns the conversion ratio of the trend at t, with the lower
+// and upper bound of its 95% confidence band. Not valid for forecasts that are
+// done.
+func (f Forecast) Conversion(t time.Time) (value float64, lower float64, upper float64) {
+	y, lo, hi := f.fit.at(days(f.origin, t))
+	if f.Model == ForecastLogistic {
+		return sigmoid(y), sigmoid(lo), sigmoid(hi)
+	}
+	return clamp(y), clamp(lo), clamp(hi)
+}
+
+// CalculateForecast fits the model to the snapshots of a query pair. It
+// returns false if there are too few snapshots to fit a trend.
+func CalculateForecast(model ForecastModel, snapshots []Snapshot) (Forecast, bool) {
+	if len(snapshots) == 0 {
+		return Forecast{Model: model}, false
+	}
+
+	latest := snapshots[len(snapshots)-1]
+	if latest.OldResults == 0 && latest.CrntResults > 0 {
+		return Forecast{Model: model, Done: true, Completion: latest.Timestamp, Earliest: latest.Timestamp, Latest: latest.Timestamp}, true
+	}
+
+	total := latest.OldResults + latest.CrntResults
+	if len(snapshots) < minForecastSnapshots || total == 0 {
+		return Forecast{Model: model}, false
+	}
+
+	origin := snapshots[0].Timestamp
+	xs := make([]float64, len(snapshots))
+	ys := make([]float64, len(snapshots))
+	for i, s := range snapshots {
+		xs[i] = days(origin, s.Timestamp)
+		ys[i] = transform(model, s)
+	}
+
+	fit, ok := fitLinear(xs, ys)
+	if !ok {
+		return Forecast{Model: model}, false
+	}
+
+	f := Forecast{Model: model, origin: origin, fit: fit}
+	for _, s := range snapshots {
+		value, _, _ := f.Conversion(s.Timestamp)
+		f.Error += math.Pow(value-s.Conversion(), 2)
+	}
+
+	// the trend in transformed values once the latest total of usages is
+	// fully converted.
+	target := transform(model, Snapshot{CrntResults: total})
+
+	// walk the days after the latest snapshot until the trend and its bounds
+	// reach the target; the bounds of the band aren't monotonic, so it's
+	// simplest to check every day.
+	for d := 0; d <= int(ForecastHorizon/(24*time.Hour)); d++ {
+		t := latest.Timestamp.AddDate(0, 0, d)
+		y, lo, hi := fit.at(days(origin, t))
+		if f.Completion.IsZero() && y >= target {
+			f.Completion = t
+		}
+		if f.Earliest.IsZero() && hi >= target {
+			f.Earliest = t
+		}
+		if f.Latest.IsZero() && lo >= target {
+			f.Latest = t
+			break
+		}
+	}
+
+	return f, true
+}
+
+// BestForecast fits every model to the snapshots and returns the one that
+// fits best. It returns false if there are too few snapshots to fit a trend.
+func BestForecast(snapshots []Snapshot) (Forecast, bool) {
+	var best Forecast
+	found := false
+	for _, model := range ForecastModels {
+		f, ok := CalculateForecast(model, snapshots)
+		if ok && (!found || f.Error < best.Error) {
+			best, found = f, true
+		}
+	}
+	return best, found
+}
+
+// transform maps a snapshot to the value the model is linear in: the
+// conversion ratio itself, or its log-odds for the logistic model. The
+// log-odds add half a usage to both counts, so they're defined for snapshots
+// without old or CRNT usages.
+func transform(model ForecastModel, s Snapshot) float64 {
+	if model == ForecastLogistic {
+		return math.Log((float64(s.CrntResults) + 0.5) / (float64(s.OldResults) + 0.5))
+	}
+	return s.Conversion()
+}
+
+// regression is a least squares fit of y = intercept + slope * x.
+type regression struct {
+	n         int
+	meanX     float64
+	sxx       float64
+	intercept float64
+	slope     float64
+	// stderr is the standard deviation of the residuals.
+	stderr float64
+	// quantile is the two-sided 95% quantile of Student's t distribution for
+	// the residuals' degrees of freedom.
+	quantile float64
+}
+
+func fitLinear(xs []float64, ys []float64) (regression, bool) {
+	n := float64(len(xs))
+
+	var meanX, meanY float64
+	for i := range xs {
+		meanX += xs[i] / n
+		meanY += ys[i] / n
+	}
+
+	var sxx, sxy float64
+	for i := range xs {
+		sxx += (xs[i] - meanX) * (xs[i] - meanX)
+		sxy += (xs[i] - meanX) * (ys[i] - meanY)
+	}
+	if sxx == 0 {
+		return regression{}, false
+	}
+
+	r := regression{n: len(xs), meanX: meanX, sxx: sxx, slope: sxy / sxx}
+	r.intercept = meanY - r.slope*meanX
+
+	var sse float64
+	for i := range xs {
+		residual := ys[i] - r.intercept - r.slope*xs[i]
+		sse += residual * residual
+	}
+	r.stderr = math.Sqrt(sse / (n - 2))
+	r.quantile = tQuantile(len(xs) - 2)
+
+	return r, true
+}
+
+// at returns the fitted value at x, with the 95% confidence band of the trend.
+func (r regression) at(x float64) (y float64, lower float64, upper float64) {
+	y = r.intercept + r.slope*x
+	margin := r.quantile * r.stderr * math.Sqrt(1/float64(r.n)+(x-r.meanX)*(x-r.meanX)/r.sxx)
+	return y, y - margin, y + margin
+}
+
+// tQuantiles are the 97.5th percentiles of Student's t distribution by degrees
+// of freedom, from 1.
+var tQuantiles = []float64{
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+func tQuantile(df int) float64 {
+	switch {
+	case df <= len(tQuantiles):
+		return tQuantiles[df-1]
+	case df <= 60:
+		return 2.021
+	case df <= 120:
+		return 2.000
+	default:
+		return 1.960
+	}
+}
+
+func days(origin time.Time, t time.Time) float64 {
+	return t.Sub(origin).Hours() / 24
+}
+
+func sigmoid(x float64) float64 {
+	return 1 / (1 + math.Exp(-x))
+}
+
+func clamp(ratio float64) float64 {
+	return math.Max(0, math.Min(1, ratio))
+}
@@ -0,0 +1,98 @@
+package domain_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/fwielstra/crntmetrics/domain"
+)
+
+func TestCalculateForecast(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := func(d int) time.Time {
+		return start.AddDate(0, 0, d)
+	}
+
+	// 100 usages, converting 10 every 10 days with some noise; done on day 90.
+	var linear []domain.Snapshot
+	for i, crnt := range []int{11, 19, 31, 40, 50} {
+		linear = append(linear, domain.Snapshot{Timestamp: day(i * 10), OldResults: 100 - crnt, CrntResults: crnt})
+	}
+
+	// an S-curve with its midpoint at day 60, converting slowly at first.
+	var logistic []domain.Snapshot
+	for d := 0; d <= 80; d += 10 {
+		crnt := int(math.Round(1000 / (1 + math.Exp(-0.1*float64(d-60)))))
+		logistic = append(logistic, domain.Snapshot{Timestamp: day(d), OldResults: 1000 - crnt, CrntResults: crnt})
+	}
+
+	tests := []struct {
+		name      string
+		model     domain.ForecastModel
+		snapshots []domain.Snapshot
+		// completion within a few days of the expected day.
+		completion int
+	}{
+		{"linear trend", domain.ForecastLinear, linear, 90},
+		// the log-odds of 999.5 / 0.5 are reached at 60 + ln(1999) / 0.1.
+		{"logistic trend", domain.ForecastLogistic, logistic, 136},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, ok := domain.CalculateForecast(tt.model, tt.snapshots)
+			if !ok {
+				t.Fatal("expected a forecast")
+			}
+
+			if got := f.Completion.Sub(day(tt.completion)).Hours() / 24; math.Abs(got) > 3 {
+				t.Errorf("expected completion around day %d, got %s", tt.completion, f.Completion.Format(time.DateOnly))
+			}
+			if f.Earliest.After(f.Completion) || f.Latest.IsZero() || f.Latest.Before(f.Completion) {
+				t.Errorf("expected completion %s between %s and %s", f.Completion, f.Earliest, f.Latest)
+			}
+
+			value, lower, upper := f.Conversion(f.Completion)
+			if value < 0.99 || lower > value || upper < value {
+				t.Errorf("expected conversion of about 1 within its band at completion, got %f (%f - %f)", value, lower, upper)
+			}
+		})
+	}
+
+	best, _ := domain.BestForecast(logistic)
+	if best.Model != domain.ForecastLogistic {
+		t.Errorf("expected the logistic model to fit an S-curve best, got %s", best.Model)
+	}
+}
+
+func TestCalculateForecastWithoutTrend(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2025, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	if _, ok := domain.CalculateForecast(domain.ForecastLinear, []domain.Snapshot{
+		{Timestamp: day(1), OldResults: 10, CrntResults: 0},
+		{Timestamp: day(2), OldResults: 5, CrntResults: 5},
+	}); ok {
+		t.Error("expected no forecast from two snapshots")
+	}
+
+	done, ok := domain.CalculateForecast(domain.ForecastLinear, []domain.Snapshot{
+		{Timestamp: day(1), OldResults: 10, CrntResults: 0},
+		{Timestamp: day(2), OldResults: 0, CrntResults: 10},
+	})
+	if !ok || !done.Done || !done.Completion.Equal(day(2)) {
+		t.Errorf("expected a done forecast completed at the latest snapshot, got %+v", done)
+	}
+
+	// usages are added faster than they're converted.
+	f, ok := domain.CalculateForecast(domain.ForecastLinear, []domain.Snapshot{
+		{Timestamp: day(1), OldResults: 10, CrntResults: 10},
+		{Timestamp: day(2), OldResults: 15, CrntResults: 10},
+		{Timestamp: day(3), OldResults: 20, CrntResults: 10},
+	})
+	if !ok || !f.Completion.IsZero() || !f.Latest.IsZero() {
+		t.Errorf("expected no completion for a declining conversion, got %+v", f)
+	}
+}
@@ -0,0 +1,156 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+// Storage persists results and the runs, projects and matches around them.
+// Implemented by sqlite for a local database file, and by postgres for a
+// shared database server.
+type Storage interface {
+	ResultRepository
+	RunRepository
+	ProjectRepository
+	MatchRepository
+	QueryVersionRepository
+
+	// Migrate applies all schema migrations that haven't been applied yet, and
+	// returns the number of migrations applied.
+	Migrate() (int, error)
+	// MigrationStatuses returns all known migrations and whether they have
+	// been applied.
+	MigrationStatuses() ([]MigrationStatus, error)
+	// Import merges the history of another database into this one in a
+	// single transaction, so a failed import leaves nothing behind. Runs that
+	// started at the same time on the same Gitlab, and results with the same
+	// timestamp, project and query, are skipped, so importing the same history
+	// twice doesn't duplicate anything.
+	Import(history History) (ImportCounts, error)
+	// Reset backs up the database, then drops all tables, so the next Migrate
+	// starts from an empty database. It returns where the backup is.
+	Reset() (backup string, err error)
+
+	Close() error
+}
+
+// ResultRepository stores the results of query pairs over time.
+type ResultRepository interface {
+	SaveResults(results []ResultRow) error
+	// LoadResults loads the results of all queries, oldest first.
+	LoadResults() ([]ResultRow, error)
+	// LoadQueryResults loads all results of a query, oldest first.
+	LoadQueryResults(query string) ([]ResultRow, error)
+	// LoadQueryResultsBetween loads the results of a query with a timestamp in
+	// [from, to], oldest first; a zero from or to leaves that side of the
+	// range open.
+	LoadQueryResultsBetween(query string, from time.Time, to time.Time) ([]ResultRow, error)
+	// LoadLatestResults loads the most recent results of every query, i.e. the
+	// results of the latest update that ran each query.
+	LoadLatestResults() ([]ResultRow, error)
+	// LoadRunResults loads the results of a single update run.
+	LoadRunResults(runID int64) ([]ResultRow, error)
+	// LoadBackfilledTimes returns the timestamps, in unix milliseconds, of
+	// the backfilled results of a project, with the names of the queries that
+	// have results at each.
+	LoadBackfilledTimes(projectID int) (map[int64]map[string]bool, error)
+	// LoadFirstUpdateTimes returns per query the timestamp of the first result
+	// of a project that wasn't backfilled, i.e. where regular updates start.
+	LoadFirstUpdateTimes(projectID int) (map[string]time.Time, error)
+	// LoadQueryNames returns the distinct names of all queries that have
+	// results, sorted by name.
+	LoadQueryNames() ([]string, error)
+}
+
+// ErrRunNotFound is returned by LoadRun if no run exists with the given ID.
+var ErrRunNotFound = errors.New("run not found")
+
+// RunRepository records update runs.
+type RunRepository interface {
+	// StartRun inserts a new run and sets its ID.
+	StartRun(run *Run) error
+	// FinishRun stores the finish time, status and errors of a run.
+	FinishRun(run *Run) error
+	// LoadRuns returns the most recent runs, newest first.
+	LoadRuns(limit int) ([]Run, error)
+	// LoadRun returns a single run, or ErrRunNotFound.
+	LoadRun(id int64) (Run, error)
+	// LoadLatestUpdateRun returns the most recent run of update, so not a
+	// backfill, or ErrRunNotFound.
+	LoadLatestUpdateRun() (Run, error)
+	// LoadRunCounts counts the runs per status and the errors of the Gitlab runs.
+	LoadRunCounts() (RunCounts, error)
+}
+
+// RunCounts summarizes all runs, for monitoring.
+type RunCounts struct {
+	// Runs is the number of runs per status.
+	Runs map[RunStatus]int
+	// GitlabErrors is the total number of failed queries across the runs
+	// against Gitlab, so excluding runs of the local backend and backfills.
+	GitlabErrors int
+	// LastFinishedAt is the finish time of the most recent finished run.
+	LastFinishedAt time.Time
+}
+
+// ProjectRepository caches the names and URLs of Gitlab projects.
+type ProjectRepository interface {
+	// SaveProjects inserts the projects, or updates them if they already exist.
+	SaveProjects(projects []*Project) error
+	// LoadProjects returns the projects that have results, with their name
+	// and URL if they are known.
+	LoadProjects() ([]Project, error)
+	// LoadProjectNames returns a lookup of project ID to name for all known projects.
+	LoadProjectNames() (ProjectNames, error)
+	// LoadProjectURLs returns a lookup of project ID to web URL for all known projects.
+	LoadProjectURLs() (map[int]string, error)
+	// LoadProjectNamespaces returns a lookup of project ID to the full path of
+	// its namespace for all known projects.
+	LoadProjectNamespaces() (map[int]string, error)
+}
+
+// MatchRepository stores the individual files matching the old query of a
+// pair.
+type MatchRepository interface {
+	SaveMatches(matches []Match) error
+	// LoadLatestMatches loads the matches of the query in the most recent
+	// finished run with details, ordered by project and path; the list is
+	// empty if that run found no matches.
+	LoadLatestMatches(query string) ([]Match, error)
+}
+
+// QueryVersionRepository stores the distinct definitions of query pairs, so
+// results can be traced back to the queries that produced them.
+type QueryVersionRepository interface {
+	// SaveQueryVersions inserts the versions that don't exist yet, identified
+	// by their query and hash. For existing versions, the earliest valid from
+	// is kept.
+	SaveQueryVersions(versions []QueryVersion) error
+	// LoadQueryVersions loads the versions of all queries, ordered by query
+	// and valid from.
+	LoadQueryVersions() ([]QueryVersion, error)
+}
+
+// MigrationStatus is a schema migration and whether it has been applied.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// History is the data of another database to import, e.g. from an export.
+type History struct {
+	Runs []Run
+	// Results refer to their run by its ID in Runs.
+	Results       []ResultRow
+	Projects      []*Project
+	QueryVersions []QueryVersion
+}
+
+// ImportCounts is the number of runs and results an import saved; the others
+// already existed.
+type ImportCounts struct {
+	Runs    int
+	Results int
+}
@@ -0,0 +1,109 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+)
+
+// hashLength is the number of hex characters of a query pair's hash; plenty
+// to tell the versions of a single query apart.
+const hashLength = 12
+
+// Hash identifies the definition of a query pair: its scope and queries. It
+// changes whenever the definition changes, so results measured with different
+// definitions can be told apart. The name isn't part of the definition, and
+// neither is the order of the projects.
+func (qp QueryPair) Hash() string {
+	scope := qp.Scope
+	scope.ProjectIDs = slices.Clone(scope.ProjectIDs)
+	slices.Sort(scope.ProjectIDs)
+
+	definition, _ := json.Marshal(struct {
+		Scope Scope  `json:"scope"`
+		Old   string `json:"old"`
+		Crnt  string `json:"crnt"`
+	}{scope, qp.Old, qp.Crnt})
+
+	return fmt.Sprintf("%x", sha256.Sum256(definition))[:hashLength]
+}
+
+// QueryVersion is a distinct definition of a query pair, and when results
+// were first measured with it.
+type QueryVersion struct {
+	Query     string    `json:"query"`
+	Hash      string    `json:"hash"`
+	Scope     Scope     `json:"scope"`
+	Old       string    `json:"old"`
+	Crnt      string    `json:"crnt"`
+	ValidFrom time.Time `json:"validFrom"`
+}
+
+// QueryVersions returns the versions of the query pairs that produced the
+// results, each valid from the earliest of its results. Query pairs without
+// results are left out.
+func QueryVersions(queryPairs []QueryPair, results []ResultRow) []QueryVersion {
+	validFrom := make(map[string]time.Time)
+	for _, res := range results {
+		if first, exists := validFrom[res.QueryName]; !exists || res.Timestamp.Before(first) {
+			validFrom[res.QueryName] = res.Timestamp
+		}
+	}
+
+	var versions []QueryVersion
+	for _, qp := range queryPairs {
+		if first, exists := validFrom[qp.Name]; exists {
+			versions = append(versions, QueryVersion{
+				Query:     qp.Name,
+				Hash:      qp.Hash(),
+				Scope:     qp.Scope,
+				Old:       qp.Old,
+				Crnt:      qp.Crnt,
+				ValidFrom: first,
+			})
+		}
+	}
+
+	return versions
+}
+
+// VersionChange is a point in time where the results of a query were
+// measured with a different definition than the results before it.
+type VersionChange struct {
+	Timestamp time.Time
+	Query     string
+	From      string
+	To        string
+}
+
+// VersionChanges finds where the definition of each query changed, ordered
+// by time. Results without a known version are skipped, so the first results
+// with a version after older unversioned ones don't count as a change.
+// Backfilled results are skipped as well: they're measured with the
+// definition at the time of the backfill, not the one in use back then.
+func VersionChanges(results []ResultRow) []VersionChange {
+	sorted := make([]ResultRow, 0, len(results))
+	for _, res := range results {
+		if res.QueryHash != "" && res.CommitSHA == "" {
+			sorted = append(sorted, res)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+	})
+
+	var changes []VersionChange
+	latest := make(map[string]string)
+	for _, res := range sorted {
+		previous, exists := latest[res.QueryName]
+		latest[res.QueryName] = res.QueryHash
+		if exists && previous != res.QueryHash {
+			changes = append(changes, VersionChange{Timestamp: res.Timestamp, Query: res.QueryName, From: previous, To: res.QueryHash})
+		}
+	}
+
+	return changes
+}
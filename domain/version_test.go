@@ -0,0 +1,99 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fwielstra/crntmetrics/domain"
+)
+
+func TestQueryPairHash(t *testing.T) {
+	qp := domain.QueryPair{Name: "icon-web", Scope: domain.Scope{ProjectIDs: []int{62}}, Old: "fa-icon", Crnt: "crnt-icon"}
+
+	renamed := qp
+	renamed.Name = "icon"
+	if qp.Hash() != renamed.Hash() {
+		t.Errorf("expected the name not to change the hash")
+	}
+
+	changed := qp
+	changed.Old = "fa-icon fa-"
+	if qp.Hash() == changed.Hash() {
+		t.Errorf("expected a changed query to change the hash")
+	}
+
+	rescoped := qp
+	rescoped.Scope = domain.Scope{Group: "frontend"}
+	if qp.Hash() == rescoped.Hash() {
+		t.Errorf("expected a changed scope to change the hash")
+	}
+
+	projects := domain.QueryPair{Scope: domain.Scope{ProjectIDs: []int{3202, 62}}, Old: "fa-icon", Crnt: "crnt-icon"}
+	reordered := projects
+	reordered.Scope = domain.Scope{ProjectIDs: []int{62, 3202}}
+	if projects.Hash() != reordered.Hash() {
+		t.Errorf("expected the order of the projects not to change the hash")
+	}
+	if projects.Scope.ProjectIDs[0] != 3202 {
+		t.Errorf("expected the hash not to sort the projects of the query pair, got %v", projects.Scope.ProjectIDs)
+	}
+}
+
+func TestVersionChanges(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2025, 6, d, 12, 0, 0, 0, time.UTC)
+	}
+
+	// out of order, with results from before versions were recorded, and two
+	// projects at the change.
+	results := []domain.ResultRow{
+		{Timestamp: day(4), ProjectID: 62, QueryName: "icon", QueryHash: "b"},
+		{Timestamp: day(4), ProjectID: 3202, QueryName: "icon", QueryHash: "b"},
+		{Timestamp: day(1), ProjectID: 62, QueryName: "icon"},
+		{Timestamp: day(2), ProjectID: 62, QueryName: "icon", QueryHash: "a"},
+		{Timestamp: day(3), ProjectID: 62, QueryName: "icon", QueryHash: "a"},
+		{Timestamp: day(3), ProjectID: 62, QueryName: "button", QueryHash: "c"},
+		{Timestamp: day(5), ProjectID: 62, QueryName: "icon", QueryHash: "a"},
+		// backfilled later with the then current definition.
+		{Timestamp: day(3), ProjectID: 62, QueryName: "icon", QueryHash: "c", CommitSHA: "abc123"},
+	}
+
+	changes := domain.VersionChanges(results)
+
+	expected := []domain.VersionChange{
+		{Timestamp: day(4), Query: "icon", From: "a", To: "b"},
+		{Timestamp: day(5), Query: "icon", From: "b", To: "a"},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected %d changes, got %+v", len(expected), changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("expected change %d to be %+v, got %+v", i, expected[i], changes[i])
+		}
+	}
+}
+
+func TestQueryVersions(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2025, 6, d, 12, 0, 0, 0, time.UTC)
+	}
+
+	pairs := []domain.QueryPair{
+		{Name: "icon", Old: "fa-icon", Crnt: "crnt-icon"},
+		{Name: "button", Old: "btn", Crnt: "crnt-button"},
+	}
+	results := []domain.ResultRow{
+		{Timestamp: day(3), QueryName: "icon"},
+		{Timestamp: day(2), QueryName: "icon"},
+	}
+
+	versions := domain.QueryVersions(pairs, results)
+
+	if len(versions) != 1 {
+		t.Fatalf("expected only the query with results to have a version, got %+v", versions)
+	}
+	if v := versions[0]; v.Query != "icon" || v.Hash != pairs[0].Hash() || !v.ValidFrom.Equal(day(2)) {
+		t.Errorf("unexpected version %+v", v)
+	}
+}
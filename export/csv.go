@@ -0,0 +1,301 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fwielstra/crntmetrics/domain"
+)
+
+// the files of a CSV export, each with a header row.
+const (
+	projectsFile = "projects.csv"
+	runsFile     = "runs.csv"
+	resultsFile  = "results.csv"
+	queriesFile  = "queries.csv"
+	versionsFile = "query_versions.csv"
+)
+
+var (
+	projectsHeader = []string{"id", "name", "namespace", "url"}
+	runsHeader     = []string{"id", "started_at", "finished_at", "gitlab_url", "config_hash", "tool_version", "status", "error_count", "errors", "details"}
+	resultsHeader  = []string{"run_id", "timestamp", "project_id", "query", "old_results", "crnt_results", "commit_sha", "query_hash"}
+	queriesHeader  = []string{"name", "project_ids", "group", "instance", "old", "crnt"}
+	versionsHeader = []string{"query", "hash", "scope", "old", "crnt", "valid_from"}
+)
+
+// WriteCSV writes the data as CSV files in dir, which is created if it
+// doesn't exist. Times are RFC 3339, and the errors of a run and the scope of
+// a query version are JSON.
+func WriteCSV(dir string, data Data) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	projects := make([][]string, len(data.Projects))
+	for i, p := range data.Projects {
+		projects[i] = []string{strconv.Itoa(p.ID), p.Name, p.Namespace, p.URL}
+	}
+
+	runs := make([][]string, len(data.Runs))
+	for i, r := range data.Runs {
+		errs, err := json.Marshal(r.Errors)
+		if err != nil {
+			return err
+		}
+		runs[i] = []string{
+			strconv.FormatInt(r.ID, 10),
+			formatTime(r.StartedAt),
+			formatTime(r.FinishedAt),
+			r.GitlabURL,
+			r.ConfigHash,
+			r.ToolVersion,
+			string(r.Status),
+			strconv.Itoa(r.ErrorCount),
+			string(errs),
+			strconv.FormatBool(r.Details),
+		}
+	}
+
+	results := make([][]string, len(data.Results))
+	for i, r := range data.Results {
+		results[i] = []string{
+			strconv.FormatInt(r.RunID, 10),
+			formatTime(r.Timestamp),
+			strconv.Itoa(r.ProjectID),
+			r.QueryName,
+			strconv.Itoa(r.OldResults),
+			strconv.Itoa(r.CrntResults),
+			r.CommitSHA,
+			r.QueryHash,
+		}
+	}
+
+	queries := make([][]string, len(data.Queries))
+	for i, q := range data.Queries {
+		ids := make([]string, len(q.ProjectIDs))
+		for j, id := range q.ProjectIDs {
+			ids[j] = strconv.Itoa(id)
+		}
+		queries[i] = []string{q.Name, strings.Join(ids, " "), q.Group, strconv.FormatBool(q.Instance), q.Old, q.Crnt}
+	}
+
+	versions := make([][]string, len(data.QueryVersions))
+	for i, v := range data.QueryVersions {
+		scope, err := json.Marshal(v.Scope)
+		if err != nil {
+			return err
+		}
+		versions[i] = []string{v.Query, v.Hash, string(scope), v.Old, v.Crnt, formatTime(v.ValidFrom)}
+	}
+
+	files := []struct {
+		name   string
+		header []string
+		rows   [][]string
+	}{
+		{projectsFile, projectsHeader, projects},
+		{runsFile, runsHeader, runs},
+		{resultsFile, resultsHeader, results},
+		{queriesFile, queriesHeader, queries},
+		{versionsFile, versionsHeader, versions},
+	}
+	for _, f := range files {
+		if err := writeCSVFile(filepath.Join(dir, f.name), f.header, f.rows); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReadCSV reads data written by WriteCSV. Missing files are skipped, so e.g.
+// a directory with only results.csv can be imported.
+func ReadCSV(dir string) (Data, error) {
+	var data Data
+
+	if info, err := os.Stat(dir); err != nil {
+		return data, err
+	} else if !info.IsDir() {
+		return data, fmt.Errorf("export.ReadCSV(): %s is not a directory", dir)
+	}
+
+	err := readCSVFile(filepath.Join(dir, projectsFile), projectsHeader, func(row []string) error {
+		id, err := strconv.Atoi(row[0])
+		if err != nil {
+			return err
+		}
+		data.Projects = append(data.Projects, domain.Project{ID: id, Name: row[1], Namespace: row[2], URL: row[3]})
+		return nil
+	})
+	if err != nil {
+		return data, err
+	}
+
+	err = readCSVFile(filepath.Join(dir, runsFile), runsHeader, func(row []string) error {
+		var r domain.Run
+		var err error
+		if r.ID, err = strconv.ParseInt(row[0], 10, 64); err != nil {
+			return err
+		}
+		if r.StartedAt, err = parseTime(row[1]); err != nil {
+			return err
+		}
+		if r.FinishedAt, err = parseTime(row[2]); err != nil {
+			return err
+		}
+		r.GitlabURL, r.ConfigHash, r.ToolVersion, r.Status = row[3], row[4], row[5], domain.RunStatus(row[6])
+		if r.ErrorCount, err = strconv.Atoi(row[7]); err != nil {
+			return err
+		}
+		if row[8] != "" {
+			if err := json.Unmarshal([]byte(row[8]), &r.Errors); err != nil {
+				return err
+			}
+		}
+		if r.Details, err = strconv.ParseBool(row[9]); err != nil {
+			return err
+		}
+		data.Runs = append(data.Runs, r)
+		return nil
+	})
+	if err != nil {
+		return data, err
+	}
+
+	err = readCSVFile(filepath.Join(dir, resultsFile), resultsHeader, func(row []string) error {
+		var r domain.ResultRow
+		var err error
+		if r.RunID, err = strconv.ParseInt(row[0], 10, 64); err != nil {
+			return err
+		}
+		if r.Timestamp, err = parseTime(row[1]); err != nil {
+			return err
+		}
+		if r.ProjectID, err = strconv.Atoi(row[2]); err != nil {
+			return err
+		}
+		r.QueryName = row[3]
+		if r.OldResults, err = strconv.Atoi(row[4]); err != nil {
+			return err
+		}
+		if r.CrntResults, err = strconv.Atoi(row[5]); err != nil {
+			return err
+		}
+		r.CommitSHA, r.QueryHash = row[6], row[7]
+		data.Results = append(data.Results, r)
+		return nil
+	})
+	if err != nil {
+		return data, err
+	}
+
+	err = readCSVFile(filepath.Join(dir, queriesFile), queriesHeader, func(row []string) error {
+		q := Query{Name: row[0], Group: row[2], Old: row[4], Crnt: row[5]}
+		for _, field := range strings.Fields(row[1]) {
+			id, err := strconv.Atoi(field)
+			if err != nil {
+				return err
+			}
+			q.ProjectIDs = append(q.ProjectIDs, id)
+		}
+		var err error
+		if q.Instance, err = strconv.ParseBool(row[3]); err != nil {
+			return err
+		}
+		data.Queries = append(data.Queries, q)
+		return nil
+	})
+	if err != nil {
+		return data, err
+	}
+
+	err = readCSVFile(filepath.Join(dir, versionsFile), versionsHeader, func(row []string) error {
+		v := domain.QueryVersion{Query: row[0], Hash: row[1], Old: row[3], Crnt: row[4]}
+		if err := json.Unmarshal([]byte(row[2]), &v.Scope); err != nil {
+			return err
+		}
+		var err error
+		if v.ValidFrom, err = parseTime(row[5]); err != nil {
+			return err
+		}
+		data.QueryVersions = append(data.QueryVersions, v)
+		return nil
+	})
+
+	return data, err
+}
+
+func writeCSVFile(path string, header []string, rows [][]string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	w := csv.NewWriter(f)
+	w.Write(header)
+	w.WriteAll(rows)
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// readCSVFile calls fn for every row of a CSV file after checking its header;
+// a file that doesn't exist has no rows.
+func readCSVFile(path string, header []string, fn func(row []string) error) error {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = len(header)
+
+	rows, err := r.ReadAll()
+	if err != nil {
+		return fmt.Errorf("export.ReadCSV(): %s: %w", path, err)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	if strings.Join(rows[0], ",") != strings.Join(header, ",") {
+		return fmt.Errorf("export.ReadCSV(): %s: unexpected header %v, expected %v", path, rows[0], header)
+	}
+
+	for i, row := range rows[1:] {
+		if err := fn(row); err != nil {
+			// +2 for the header and to count from 1.
+			return fmt.Errorf("export.ReadCSV(): %s: line %d: %w", path, i+2, err)
+		}
+	}
+
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
@@ -0,0 +1,56 @@
+// Package export writes stored data to portable files and reads it back, to
+// move history between databases. Two formats are supported: JSON Lines, a
+// single file with one record per line, and CSV, a directory with a file per
+// kind of record.
+package export
+
+import (
+	"github.com/fwielstra/crntmetrics/domain"
+)
+
+// Data is everything that's exported.
+type Data struct {
+	Projects []domain.Project
+	Runs     []domain.Run
+	Results  []domain.ResultRow
+	Queries  []Query
+	// QueryVersions are the stored definitions the results were measured
+	// with, unlike Queries, which are the definitions in the config file.
+	QueryVersions []domain.QueryVersion
+}
+
+// Query is the definition of a query pair, as in the config file.
+type Query struct {
+	Name       string `json:"name"`
+	ProjectIDs []int  `json:"projectIds,omitempty"`
+	Group      string `json:"group,omitempty"`
+	Instance   bool   `json:"instance,omitempty"`
+	Old        string `json:"old"`
+	Crnt       string `json:"crnt"`
+}
+
+// NewQuery converts a query pair to its exported definition.
+func NewQuery(qp domain.QueryPair) Query {
+	return Query{
+		Name:       qp.Name,
+		ProjectIDs: qp.Scope.ProjectIDs,
+		Group:      qp.Scope.Group,
+		Instance:   qp.Scope.Instance,
+		Old:        qp.Old,
+		Crnt:       qp.Crnt,
+	}
+}
+
+// QueryPair converts the exported definition back to a query pair.
+func (q Query) QueryPair() domain.QueryPair {
+	return domain.QueryPair{
+		Name: q.Name,
+		Scope: domain.Scope{
+			ProjectIDs: q.ProjectIDs,
+			Group:      q.Group,
+			Instance:   q.Instance,
+		},
+		Old:  q.Old,
+		Crnt: q.Crnt,
+	}
+}
@@ -0,0 +1,79 @@
+package export_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fwielstra/crntmetrics/domain"
+	"github.com/fwielstra/crntmetrics/export"
+)
+
+func testData() export.Data {
+	started := time.Date(2025, 6, 1, 12, 0, 0, 123000000, time.UTC)
+
+	return export.Data{
+		Projects: []domain.Project{
+			{ID: 62, Name: "web", Namespace: "frontend", URL: "https://gitlab.example.com/frontend/web"},
+		},
+		Runs: []domain.Run{
+			{ID: 1, StartedAt: started, FinishedAt: started.Add(time.Minute), GitlabURL: "https://gitlab.example.com", ConfigHash: "abc", ToolVersion: "v1.0.0", Status: domain.RunStatusPartial, ErrorCount: 1, Errors: []string{`query "icon": timeout, retrying`}},
+			{ID: 2, StartedAt: started.Add(time.Hour), GitlabURL: "https://gitlab.example.com", Status: domain.RunStatusRunning},
+		},
+		Results: []domain.ResultRow{
+			{RunID: 1, Timestamp: started, ProjectID: 62, QueryName: "icon", QueryHash: "0123456789ab", OldResults: 10, CrntResults: 5},
+			{Timestamp: started.Add(-24 * time.Hour), ProjectID: 62, QueryName: "icon", OldResults: 12, CrntResults: 2, CommitSHA: "deadbeef"},
+		},
+		Queries: []export.Query{
+			{Name: "icon", ProjectIDs: []int{62, 3202}, Old: `"fa-icon"`, Crnt: "crnt-icon"},
+			{Name: "button", Instance: true, Old: "old-button", Crnt: "crnt-button"},
+		},
+		QueryVersions: []domain.QueryVersion{
+			{Query: "icon", Hash: "0123456789ab", Scope: domain.Scope{ProjectIDs: []int{62, 3202}}, Old: `"fa-icon"`, Crnt: "crnt-icon", ValidFrom: started},
+		},
+	}
+}
+
+func TestJSONLRoundTrip(t *testing.T) {
+	data := testData()
+
+	var buf bytes.Buffer
+	if err := export.WriteJSONL(&buf, data); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := export.ReadJSONL(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(read, data) {
+		t.Errorf("expected %+v, got %+v", data, read)
+	}
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	data := testData()
+	dir := t.TempDir()
+
+	if err := export.WriteCSV(dir, data); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := export.ReadCSV(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(read, data) {
+		t.Errorf("expected %+v, got %+v", data, read)
+	}
+}
+
+func TestReadJSONLUnknownType(t *testing.T) {
+	_, err := export.ReadJSONL(bytes.NewBufferString(`{"type":"match"}` + "\n"))
+	if err == nil {
+		t.Errorf("expected an error for an unknown record type")
+	}
+}
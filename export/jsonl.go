@@ -0,0 +1,105 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/fwielstra/crntmetrics/domain"
+)
+
+// record is a line in a JSON Lines export; Type says which of the other
+// fields is set.
+type record struct {
+	Type    string            `json:"type"`
+	Project *domain.Project   `json:"project,omitempty"`
+	Run     *domain.Run       `json:"run,omitempty"`
+	Result  *domain.ResultRow `json:"result,omitempty"`
+	Query   *Query            `json:"query,omitempty"`
+
+	QueryVersion *domain.QueryVersion `json:"queryVersion,omitempty"`
+}
+
+const (
+	typeProject = "project"
+	typeRun     = "run"
+	typeResult  = "result"
+	typeQuery   = "query"
+
+	typeQueryVersion = "queryVersion"
+)
+
+// WriteJSONL writes the data as JSON Lines, with projects, runs, queries and
+// query versions before the results that refer to them.
+func WriteJSONL(w io.Writer, data Data) error {
+	enc := json.NewEncoder(w)
+
+	for i := range data.Projects {
+		if err := enc.Encode(record{Type: typeProject, Project: &data.Projects[i]}); err != nil {
+			return err
+		}
+	}
+	for i := range data.Runs {
+		if err := enc.Encode(record{Type: typeRun, Run: &data.Runs[i]}); err != nil {
+			return err
+		}
+	}
+	for i := range data.Queries {
+		if err := enc.Encode(record{Type: typeQuery, Query: &data.Queries[i]}); err != nil {
+			return err
+		}
+	}
+	for i := range data.QueryVersions {
+		if err := enc.Encode(record{Type: typeQueryVersion, QueryVersion: &data.QueryVersions[i]}); err != nil {
+			return err
+		}
+	}
+	for i := range data.Results {
+		if err := enc.Encode(record{Type: typeResult, Result: &data.Results[i]}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReadJSONL reads data written by WriteJSONL. Records can be in any order;
+// blank lines are skipped.
+func ReadJSONL(r io.Reader) (Data, error) {
+	var data Data
+
+	scanner := bufio.NewScanner(r)
+	// snippets and run errors can make for long lines.
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var rec record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return data, fmt.Errorf("export.ReadJSONL(): line %d: %w", line, err)
+		}
+
+		switch {
+		case rec.Type == typeProject && rec.Project != nil:
+			data.Projects = append(data.Projects, *rec.Project)
+		case rec.Type == typeRun && rec.Run != nil:
+			data.Runs = append(data.Runs, *rec.Run)
+		case rec.Type == typeResult && rec.Result != nil:
+			data.Results = append(data.Results, *rec.Result)
+		case rec.Type == typeQuery && rec.Query != nil:
+			data.Queries = append(data.Queries, *rec.Query)
+		case rec.Type == typeQueryVersion && rec.QueryVersion != nil:
+			data.QueryVersions = append(data.QueryVersions, *rec.QueryVersion)
+		default:
+			return data, fmt.Errorf("export.ReadJSONL(): line %d: unknown record type %q", line, rec.Type)
+		}
+	}
+
+	return data, scanner.Err()
+}
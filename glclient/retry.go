@@ -0,0 +1,198 @@
+package glclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// RetryPolicy configures how often and how long to wait before retrying a
+// failed request. Delays grow exponentially from BaseDelay up to MaxDelay, with
+// full jitter so workers that failed at the same time don't retry in lockstep.
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 4,
+	BaseDelay:  time.Second,
+	MaxDelay:   30 * time.Second,
+}
+
+// Backoff returns the delay before the given retry, starting at 0.
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	delay := p.MaxDelay
+	// guard against overflow for large retry counts.
+	if retry < 32 {
+		delay = min(p.BaseDelay<<retry, p.MaxDelay)
+	}
+
+	if delay <= 0 {
+		return 0
+	}
+
+	return rand.N(delay + 1)
+}
+
+// rateLimitPause makes all requests of a Search wait once Gitlab tells us
+// we've used up our rate limit, not just the one that got the response.
+type rateLimitPause struct {
+	mu    sync.Mutex
+	until time.Time
+}
+
+func (p *rateLimitPause) extend(until time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if until.After(p.until) {
+		p.until = until
+	}
+}
+
+func (p *rateLimitPause) wait(ctx context.Context) error {
+	p.mu.Lock()
+	delay := time.Until(p.until)
+	p.mu.Unlock()
+
+	return sleep(ctx, delay)
+}
+
+// do calls the Gitlab API through the rate limiter, retrying on rate limiting,
+// server errors and network errors according to the retry policy.
+func (s *Search) do(ctx context.Context, call func(options ...gitlab.RequestOptionFunc) (*gitlab.Response, error)) error {
+	var err error
+
+	for retry := 0; ; retry++ {
+		if err := s.pause.wait(ctx); err != nil {
+			return err
+		}
+
+		if s.Limiter != nil {
+			if err := s.Limiter.Wait(ctx); err != nil {
+				return err
+			}
+		}
+
+		var resp *gitlab.Response
+		resp, err = call(gitlab.WithContext(ctx))
+
+		if resp != nil {
+			if reset, limited := rateLimitReset(resp.Header, time.Now()); limited {
+				s.pause.extend(reset)
+			}
+		}
+
+		if err == nil || !retryable(ctx, resp, err) || retry >= s.Retry.MaxRetries {
+			break
+		}
+
+		delay := s.Retry.Backoff(retry)
+		if resp != nil {
+			if after, ok := retryAfter(resp.Header, time.Now()); ok {
+				delay = after
+			}
+		}
+
+		log.Printf("request failed, retry %d of %d in %s: %v", retry+1, s.Retry.MaxRetries, delay.Round(time.Millisecond), err)
+
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+
+	if err != nil && s.Retry.MaxRetries > 0 && retryable(ctx, nil, err) {
+		return fmt.Errorf("giving up after %d retries: %w", s.Retry.MaxRetries, err)
+	}
+
+	return err
+}
+
+// retryable returns whether a failed request is worth retrying: rate limiting,
+// server errors and network errors are, client errors and cancellation aren't.
+func retryable(ctx context.Context, resp *gitlab.Response, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var errResp *gitlab.ErrorResponse
+	if errors.As(err, &errResp) && errResp.Response != nil {
+		return retryableStatus(errResp.Response.StatusCode)
+	}
+
+	if resp != nil && resp.Response != nil {
+		return retryableStatus(resp.StatusCode)
+	}
+
+	// no response at all, e.g. a connection reset.
+	return true
+}
+
+func retryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// retryAfter parses the Retry-After header, which is either a number of
+// seconds or an HTTP date.
+func retryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+
+	return 0, false
+}
+
+// rateLimitReset returns when the rate limit resets if the RateLimit-* headers
+// say there are no requests remaining.
+func rateLimitReset(header http.Header, now time.Time) (time.Time, bool) {
+	remaining, err := strconv.Atoi(header.Get("RateLimit-Remaining"))
+	if err != nil || remaining > 0 {
+		return time.Time{}, false
+	}
+
+	reset, err := strconv.ParseInt(header.Get("RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	resetAt := time.Unix(reset, 0)
+	if !resetAt.After(now) {
+		return time.Time{}, false
+	}
+
+	return resetAt, true
+}
+
+func sleep(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
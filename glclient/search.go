@@ -1,40 +1,162 @@
 package glclient
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"slices"
 
 	domain "github.com/fwielstra/crntmetrics/domain"
 	gitlab "gitlab.com/gitlab-org/api/client-go"
+	"golang.org/x/time/rate"
 )
 
+// Search implements domain.Searcher using Gitlab's advanced search API.
 type Search struct {
 	Client  *gitlab.Client
 	Verbose bool
+	// Limiter limits the rate of search requests, nil means no limit.
+	Limiter *rate.Limiter
+	// Retry sets how failed requests are retried; the zero value doesn't retry.
+	Retry RetryPolicy
+
+	pause rateLimitPause
+}
+
+// CountCode counts the matches of the query per project in the given scope.
+func (s *Search) CountCode(ctx context.Context, query string, scope domain.Scope) (map[int]int, error) {
+	switch {
+	case scope.Instance:
+		return s.CountCodeByInstance(ctx, query)
+	case scope.Group != "":
+		return s.CountCodeByGroup(ctx, query, scope.Group)
+	}
+
+	counts := make(map[int]int, len(scope.ProjectIDs))
+	for _, projectID := range scope.ProjectIDs {
+		count, err := s.CountCodeByProject(ctx, query, projectID)
+		if err != nil {
+			return nil, fmt.Errorf("error searching project %d: %w", projectID, err)
+		}
+		counts[projectID] = count
+	}
+
+	return counts, nil
 }
 
-func (s *Search) CountCodeByProject(query string, projectID int) (int, error) {
+func (s *Search) CountCodeByProject(ctx context.Context, query string, projectID int) (int, error) {
 	opts := &gitlab.SearchOptions{
 		ListOptions: gitlab.ListOptions{
 			PerPage: 1,
 		},
 	}
 
-	_, resp, err := s.Client.Search.BlobsByProject(projectID, query, opts)
+	var total int
+	err := s.do(ctx, func(options ...gitlab.RequestOptionFunc) (*gitlab.Response, error) {
+		_, resp, err := s.Client.Search.BlobsByProject(projectID, query, opts, options...)
+		if err != nil {
+			return resp, err
+		}
+		total = resp.TotalItems
+		return resp, nil
+	})
 
 	if err != nil {
 		return -1, err
 	}
 
-	return resp.TotalItems, nil
+	return total, nil
 }
 
-// TODO: if we only want the count we don't need to query all pages if we already limit to 1 project. But we'll want to search multiple projects eventually.
-func (s *Search) SearchCodeByProject(query string, projectID int) ([]*domain.SearchResult, error) {
-	opts := &gitlab.SearchOptions{}
+// CountCodeByGroup counts the matches per project in a group and its
+// subgroups. The total count doesn't tell us which projects matched, so this
+// needs to fetch every page of results.
+func (s *Search) CountCodeByGroup(ctx context.Context, query string, group string) (map[int]int, error) {
+	results, err := s.SearchCodeByGroup(ctx, query, group)
+	if err != nil {
+		return nil, err
+	}
+
+	return domain.CountByProject(results), nil
+}
+
+// CountCodeByInstance counts the matches per project across the whole instance.
+func (s *Search) CountCodeByInstance(ctx context.Context, query string) (map[int]int, error) {
+	results, err := s.SearchCodeByInstance(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return domain.CountByProject(results), nil
+}
+
+// SearchCode fetches all search results of the query in the given scope.
+func (s *Search) SearchCode(ctx context.Context, query string, scope domain.Scope) ([]*domain.SearchResult, error) {
+	switch {
+	case scope.Instance:
+		return s.SearchCodeByInstance(ctx, query)
+	case scope.Group != "":
+		return s.SearchCodeByGroup(ctx, query, scope.Group)
+	}
+
+	var results []*domain.SearchResult
+	for _, projectID := range scope.ProjectIDs {
+		projectResults, err := s.SearchCodeByProject(ctx, query, projectID)
+		if err != nil {
+			return nil, fmt.Errorf("error searching project %d: %w", projectID, err)
+		}
+		results = append(results, projectResults...)
+	}
+
+	return results, nil
+}
+
+// SearchCodeByGroup fetches all search results in a group and its subgroups.
+func (s *Search) SearchCodeByGroup(ctx context.Context, query string, group string) ([]*domain.SearchResult, error) {
+	results, err := s.searchAll(ctx, query, func(opts *gitlab.SearchOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.Blob, *gitlab.Response, error) {
+		return s.Client.Search.BlobsByGroup(group, query, opts, options...)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error searching group %s: %w", group, err)
+	}
+
+	return results, nil
+}
+
+// SearchCodeByInstance fetches all search results across the whole instance.
+func (s *Search) SearchCodeByInstance(ctx context.Context, query string) ([]*domain.SearchResult, error) {
+	results, err := s.searchAll(ctx, query, func(opts *gitlab.SearchOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.Blob, *gitlab.Response, error) {
+		return s.Client.Search.Blobs(query, opts, options...)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error searching instance: %w", err)
+	}
+
+	return results, nil
+}
+
+func (s *Search) SearchCodeByProject(ctx context.Context, query string, projectID int) ([]*domain.SearchResult, error) {
+	return s.searchAll(ctx, query, func(opts *gitlab.SearchOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.Blob, *gitlab.Response, error) {
+		return s.Client.Search.BlobsByProject(projectID, query, opts, options...)
+	})
+}
+
+// searchAll fetches all pages of blob search results using the given search function.
+func (s *Search) searchAll(ctx context.Context, query string, search func(opts *gitlab.SearchOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.Blob, *gitlab.Response, error)) ([]*domain.SearchResult, error) {
+	opts := &gitlab.SearchOptions{
+		ListOptions: gitlab.ListOptions{
+			PerPage: 100,
+		},
+	}
 
 	it, hasErr := gitlab.Scan(func(p gitlab.PaginationOptionFunc) ([]*domain.SearchResult, *gitlab.Response, error) {
-		blobs, resp, err := s.Client.Search.BlobsByProject(projectID, query, opts, p)
+		var blobs []*gitlab.Blob
+		var resp *gitlab.Response
+		err := s.do(ctx, func(options ...gitlab.RequestOptionFunc) (*gitlab.Response, error) {
+			var err error
+			blobs, resp, err = search(opts, append(options, p)...)
+			return resp, err
+		})
 		if err != nil {
 			return nil, nil, err
 		}
@@ -43,20 +165,81 @@ func (s *Search) SearchCodeByProject(query string, projectID int) ([]*domain.Sea
 			log.Printf("fetched page %d of %d for query '%s'", resp.CurrentPage, resp.TotalPages, query)
 		}
 
-		results := make([]*domain.SearchResult, len(blobs))
-		for i, blob := range blobs {
-			results[i] = &domain.SearchResult{
-				ProjectID: blob.ProjectID,
-			}
-		}
-		return results, resp, err
+		return toSearchResults(blobs), resp, err
 	})
 
 	allResults := slices.Collect(it)
 	if err := hasErr(); err != nil {
-		log.Printf("error fetching projects: %v", err)
 		return nil, err
 	}
 
 	return allResults, nil
 }
+
+// SampleCode counts the matches of the query in the given scope and fetches up
+// to n of them, from a single request for the first page of each search: one
+// for a group or the instance, one per project otherwise. Unlike CountCode it
+// doesn't tell which projects matched, but it never pages through all results.
+func (s *Search) SampleCode(ctx context.Context, query string, scope domain.Scope, n int) (int, []*domain.SearchResult, error) {
+	opts := &gitlab.SearchOptions{
+		ListOptions: gitlab.ListOptions{
+			// Gitlab returns its default page size for 0.
+			PerPage: max(n, 1),
+		},
+	}
+
+	var searches []func(options ...gitlab.RequestOptionFunc) ([]*gitlab.Blob, *gitlab.Response, error)
+	switch {
+	case scope.Instance:
+		searches = append(searches, func(options ...gitlab.RequestOptionFunc) ([]*gitlab.Blob, *gitlab.Response, error) {
+			return s.Client.Search.Blobs(query, opts, options...)
+		})
+	case scope.Group != "":
+		searches = append(searches, func(options ...gitlab.RequestOptionFunc) ([]*gitlab.Blob, *gitlab.Response, error) {
+			return s.Client.Search.BlobsByGroup(scope.Group, query, opts, options...)
+		})
+	default:
+		for _, projectID := range scope.ProjectIDs {
+			searches = append(searches, func(options ...gitlab.RequestOptionFunc) ([]*gitlab.Blob, *gitlab.Response, error) {
+				return s.Client.Search.BlobsByProject(projectID, query, opts, options...)
+			})
+		}
+	}
+
+	var total int
+	var results []*domain.SearchResult
+	for _, search := range searches {
+		var blobs []*gitlab.Blob
+		err := s.do(ctx, func(options ...gitlab.RequestOptionFunc) (*gitlab.Response, error) {
+			var resp *gitlab.Response
+			var err error
+			blobs, resp, err = search(options...)
+			if err != nil {
+				return resp, err
+			}
+			total += resp.TotalItems
+			return resp, nil
+		})
+		if err != nil {
+			return -1, nil, err
+		}
+
+		results = append(results, toSearchResults(blobs)...)
+	}
+
+	return total, results[:min(len(results), n)], nil
+}
+
+func toSearchResults(blobs []*gitlab.Blob) []*domain.SearchResult {
+	results := make([]*domain.SearchResult, len(blobs))
+	for i, blob := range blobs {
+		results[i] = &domain.SearchResult{
+			ProjectID: blob.ProjectID,
+			Path:      blob.Path,
+			Ref:       blob.Ref,
+			StartLine: blob.Startline,
+			Snippet:   blob.Data,
+		}
+	}
+	return results
+}
@@ -0,0 +1,179 @@
+package glclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fwielstra/crntmetrics/domain"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+func newTestSearch(t *testing.T, handler http.HandlerFunc) *Search {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client, err := gitlab.NewClient("token", gitlab.WithBaseURL(server.URL+"/api/v4"), gitlab.WithoutRetries())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Search{
+		Client: client,
+		Retry: RetryPolicy{
+			MaxRetries: 3,
+			BaseDelay:  time.Millisecond,
+			MaxDelay:   10 * time.Millisecond,
+		},
+	}
+}
+
+func TestCountCodeByProjectRetriesServerErrors(t *testing.T) {
+	var requests atomic.Int32
+	search := newTestSearch(t, func(w http.ResponseWriter, r *http.Request) {
+		switch requests.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Header().Set("X-Total", "7")
+			w.Write([]byte("[]"))
+		}
+	})
+
+	count, err := search.CountCodeByProject(context.Background(), "fa-icon", 62)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if count != 7 {
+		t.Errorf("expected count 7, got %d", count)
+	}
+
+	if requests.Load() != 3 {
+		t.Errorf("expected 3 requests, got %d", requests.Load())
+	}
+}
+
+func TestCountCodeByProjectGivesUp(t *testing.T) {
+	var requests atomic.Int32
+	search := newTestSearch(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	if _, err := search.CountCodeByProject(context.Background(), "fa-icon", 62); err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	if requests.Load() != 4 {
+		t.Errorf("expected 1 request and 3 retries, got %d requests", requests.Load())
+	}
+}
+
+func TestCountCodeByProjectDoesNotRetryClientErrors(t *testing.T) {
+	var requests atomic.Int32
+	search := newTestSearch(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	})
+
+	if _, err := search.CountCodeByProject(context.Background(), "fa-icon", 62); err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	if requests.Load() != 1 {
+		t.Errorf("expected a single request, got %d", requests.Load())
+	}
+}
+
+func TestSampleCodeRequestsFirstPageOnly(t *testing.T) {
+	var requests atomic.Int32
+	search := newTestSearch(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Path != "/api/v4/groups/shop/-/search" || r.URL.Query().Get("per_page") != "2" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		// more results than a page, which must not be fetched.
+		w.Header().Set("X-Total", "250")
+		w.Header().Set("X-Total-Pages", "125")
+		w.Header().Set("X-Next-Page", "2")
+		w.Write([]byte(`[{"project_id": 62, "path": "a.html"}, {"project_id": 3202, "path": "b.html"}]`))
+	})
+
+	total, samples, err := search.SampleCode(context.Background(), "fa-icon", domain.Scope{Group: "shop"}, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if total != 250 {
+		t.Errorf("expected total 250, got %d", total)
+	}
+	if len(samples) != 2 || samples[1].Path != "b.html" {
+		t.Errorf("expected the 2 results of the first page, got %v", samples)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("expected a single request, got %d", requests.Load())
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"5", 5 * time.Second, true},
+		{now.Add(time.Minute).Format(http.TimeFormat), time.Minute, true},
+		{"soon", 0, false},
+	}
+
+	for _, tt := range tests {
+		header := http.Header{}
+		header.Set("Retry-After", tt.value)
+
+		got, ok := retryAfter(header, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("retryAfter(%q) = %s, %t; want %s, %t", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRateLimitReset(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	reset := now.Add(30 * time.Second)
+
+	header := http.Header{}
+	header.Set("RateLimit-Remaining", "0")
+	header.Set("RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+
+	if got, ok := rateLimitReset(header, now); !ok || !got.Equal(reset) {
+		t.Errorf("expected reset at %s, got %s, %t", reset, got, ok)
+	}
+
+	header.Set("RateLimit-Remaining", "3")
+	if _, ok := rateLimitReset(header, now); ok {
+		t.Errorf("expected no reset with requests remaining")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+
+	for retry := 0; retry < 100; retry++ {
+		if delay := policy.Backoff(retry); delay < 0 || delay > policy.MaxDelay {
+			t.Errorf("backoff for retry %d out of range: %s", retry, delay)
+		}
+	}
+}
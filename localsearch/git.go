@@ -0,0 +1,257 @@
+package localsearch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Commit is a commit on the history of a branch.
+type Commit struct {
+	SHA  string
+	Time time.Time
+}
+
+// GitTree is the tree of a commit in a local git repository, read with git
+// itself so the working tree doesn't need to be checked out.
+type GitTree struct {
+	Dir    string
+	Commit string
+}
+
+func (g GitTree) Walk(include func(path string) bool, fn func(path string, content []byte) error) error {
+	// -l adds the object size, so large files can be skipped without reading them.
+	out, err := git(g.Dir, "ls-tree", "-r", "-z", "-l", g.Commit)
+	if err != nil {
+		return err
+	}
+
+	var objects, paths []string
+	for _, entry := range bytes.Split(out, []byte{0}) {
+		// <mode> SP <type> SP <object> SP+ <size> TAB <path>
+		meta, path, found := strings.Cut(string(entry), "\t")
+		fields := strings.Fields(meta)
+		if !found || len(fields) != 4 || fields[1] != "blob" {
+			continue
+		}
+
+		size, err := strconv.Atoi(fields[3])
+		if err != nil || size > maxFileSize {
+			continue
+		}
+
+		// committed dependencies are skipped like in a working tree, so both
+		// count the same.
+		if inSkippedDir(path) || !include(path) {
+			continue
+		}
+
+		objects = append(objects, fields[2])
+		paths = append(paths, path)
+	}
+
+	if len(objects) == 0 {
+		return nil
+	}
+
+	return catFiles(g.Dir, objects, func(i int, content []byte) error {
+		if isBinary(content) {
+			return nil
+		}
+		return fn(paths[i], content)
+	})
+}
+
+// catFiles reads the contents of the objects with a single git cat-file
+// process, calling fn with the index and contents of each object in order.
+func catFiles(dir string, objects []string, fn func(i int, content []byte) error) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "cat-file", "--batch")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	go func() {
+		defer stdin.Close()
+		w := bufio.NewWriter(stdin)
+		for _, object := range objects {
+			fmt.Fprintln(w, object)
+		}
+		w.Flush()
+	}()
+
+	r := bufio.NewReader(stdout)
+	for i := range objects {
+		// <object> SP <type> SP <size> LF <contents> LF
+		header, err := r.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("error reading git cat-file output: %w", err)
+		}
+
+		fields := strings.Fields(header)
+		if len(fields) != 3 {
+			return fmt.Errorf("unexpected git cat-file output %q", header)
+		}
+
+		size, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return fmt.Errorf("unexpected git cat-file output %q", header)
+		}
+
+		content := make([]byte, size+1)
+		if _, err := io.ReadFull(r, content); err != nil {
+			return fmt.Errorf("error reading git cat-file output: %w", err)
+		}
+
+		if err := fn(i, content[:size]); err != nil {
+			return err
+		}
+	}
+
+	return cmd.Wait()
+}
+
+// DefaultBranch returns the default branch of the repository, i.e. the
+// branch origin/HEAD points to, or the checked out branch if there is no
+// remote.
+func DefaultBranch(dir string) (string, error) {
+	if out, err := git(dir, "symbolic-ref", "--short", "refs/remotes/origin/HEAD"); err == nil {
+		return strings.TrimSpace(string(out)), nil
+	}
+
+	out, err := git(dir, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// ListCommits returns the first parent history of a branch, oldest first; the
+// commits that were the tip of the branch at some point, ignoring the commits
+// of merged branches.
+func ListCommits(dir string, branch string) ([]Commit, error) {
+	out, err := git(dir, "log", "--first-parent", "--reverse", "--format=%H %ct", branch, "--")
+	if err != nil {
+		return nil, err
+	}
+
+	var commits []Commit
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		sha, ts, found := strings.Cut(line, " ")
+		if !found {
+			continue
+		}
+
+		seconds, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected git log output %q", line)
+		}
+
+		commits = append(commits, Commit{SHA: sha, Time: time.Unix(seconds, 0)})
+	}
+
+	return commits, nil
+}
+
+// Interval is how often to sample the history of a branch.
+type Interval string
+
+const (
+	Daily   Interval = "daily"
+	Weekly  Interval = "weekly"
+	Monthly Interval = "monthly"
+)
+
+func ParseInterval(value string) (Interval, error) {
+	switch i := Interval(value); i {
+	case Daily, Weekly, Monthly:
+		return i, nil
+	}
+	return "", fmt.Errorf("invalid interval %q, expected daily, weekly or monthly", value)
+}
+
+// start returns the start of the period t falls in, in the local timezone.
+func (i Interval) start(t time.Time) time.Time {
+	year, month, day := t.In(time.Local).Date()
+	switch i {
+	case Daily:
+		return time.Date(year, month, day, 0, 0, 0, 0, time.Local)
+	case Weekly:
+		// ISO weeks start on monday.
+		monday := time.Date(year, month, day, 0, 0, 0, 0, time.Local)
+		return monday.AddDate(0, 0, -((int(monday.Weekday()) + 6) % 7))
+	}
+	return time.Date(year, month, 1, 0, 0, 0, 0, time.Local)
+}
+
+// next returns the start of the period after the one starting at start.
+func (i Interval) next(start time.Time) time.Time {
+	switch i {
+	case Daily:
+		return start.AddDate(0, 0, 1)
+	case Weekly:
+		return start.AddDate(0, 0, 7)
+	}
+	return start.AddDate(0, 1, 0)
+}
+
+// Sample is the state of a branch at the end of a period.
+type Sample struct {
+	// Commit is the last commit before the end of the period.
+	Commit Commit
+	// At is the end of the period, the same for every branch sampled with the
+	// same interval.
+	At time.Time
+}
+
+// SampleCommits returns the state of the branch at the end of every period
+// from the one of the first commit up to until, ignoring the period until
+// falls in as it isn't over yet. Periods without commits repeat the commit
+// before them, so the samples of different branches line up. The commits must
+// be ordered oldest first.
+func SampleCommits(commits []Commit, interval Interval, until time.Time) []Sample {
+	if len(commits) == 0 {
+		return nil
+	}
+
+	var samples []Sample
+	last := 0
+	for end := interval.next(interval.start(commits[0].Time)); !end.After(until); end = interval.next(end) {
+		for last+1 < len(commits) && commits[last+1].Time.Before(end) {
+			last++
+		}
+		samples = append(samples, Sample{Commit: commits[last], At: end})
+	}
+	return samples
+}
+
+func git(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+
+	return out, nil
+}
@@ -0,0 +1,98 @@
+package localsearch_test
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fwielstra/crntmetrics/localsearch"
+)
+
+func TestSampleCommits(t *testing.T) {
+	commit := func(sha string, date string) localsearch.Commit {
+		ts, err := time.ParseInLocation(time.DateOnly, date, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return localsearch.Commit{SHA: sha, Time: ts}
+	}
+
+	commits := []localsearch.Commit{
+		commit("a", "2025-01-06"), // monday, week 2
+		commit("b", "2025-01-12"), // sunday, week 2
+		commit("c", "2025-01-13"), // monday, week 3
+		commit("d", "2025-01-31"), // friday, week 5
+		commit("e", "2025-02-01"), // saturday, week 5
+		commit("f", "2025-02-01"),
+	}
+	until := commit("", "2025-02-03").Time // monday, week 6
+
+	// every period until the last one that ended, with the last commit before
+	// its end; a commit at midnight belongs to the next period.
+	tests := []struct {
+		interval  localsearch.Interval
+		want      string
+		wantFirst string
+	}{
+		{localsearch.Daily, "aaaaaab" + strings.Repeat("c", 18) + "dff", "2025-01-07"},
+		{localsearch.Weekly, "bccf", "2025-01-13"},
+		{localsearch.Monthly, "d", "2025-02-01"},
+	}
+
+	for _, tt := range tests {
+		samples := localsearch.SampleCommits(commits, tt.interval, until)
+
+		got := ""
+		for _, s := range samples {
+			got += s.Commit.SHA
+		}
+		if got != tt.want {
+			t.Errorf("SampleCommits(%s) = %s, want %s", tt.interval, got, tt.want)
+		}
+
+		if first := commit("", tt.wantFirst).Time; len(samples) == 0 || !samples[0].At.Equal(first) {
+			t.Errorf("SampleCommits(%s) starts at %v, want the end of the first period %v", tt.interval, samples, first)
+		}
+	}
+
+	if samples := localsearch.SampleCommits(nil, localsearch.Weekly, until); len(samples) != 0 {
+		t.Errorf("expected no samples without commits, got %v", samples)
+	}
+}
+
+func TestGitTreeWalk(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"src/app.html":                "<fa-icon></fa-icon>",
+		"node_modules/lib/index.html": "<fa-icon></fa-icon>",
+		"src/node_modules/x.html":     "<fa-icon></fa-icon>",
+	})
+
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "initial"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+
+	var paths []string
+	tree := localsearch.GitTree{Dir: dir, Commit: "HEAD"}
+	err := tree.Walk(func(string) bool { return true }, func(path string, content []byte) error {
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// committed dependencies are skipped, like in a working tree.
+	if fmt.Sprint(paths) != "[src/app.html]" {
+		t.Errorf("expected only src/app.html, got %v", paths)
+	}
+}
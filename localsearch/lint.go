@@ -0,0 +1,68 @@
+package localsearch
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// looksLikeFilter matches terms like ext:html, that were probably meant as a
+// filter but that Gitlab searches for as text.
+var looksLikeFilter = regexp.MustCompile(`^[a-z_]+:[^/\s]+$`)
+
+// Lint returns the problems with a query: syntax errors, and syntax that is
+// valid but likely doesn't search for what was intended.
+func Lint(query string) []string {
+	q, err := Parse(query)
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	var problems []string
+
+	// Parse succeeded, so tokenize does too.
+	tokens, _ := tokenize(query)
+	for i, t := range tokens {
+		if i > 0 && t.joined && t.kind == tokenPhrase && tokens[i-1].kind == tokenTerm {
+			problems = append(problems, fmt.Sprintf("%s and %q are searched as separate terms, not as one text; put the whole text in one phrase", tokens[i-1].text, t.text))
+		}
+	}
+
+	for _, t := range terms(q.Expr) {
+		if !t.Phrase && looksLikeFilter.MatchString(t.Text) {
+			name, _, _ := strings.Cut(t.Text, ":")
+			problems = append(problems, fmt.Sprintf("unknown filter %s: is searched as text, filters are extension:, filename: and path:", name))
+		}
+	}
+
+	if q.Expr == nil {
+		problems = append(problems, "query only has filters, so it matches every file")
+	} else if _, ok := q.Expr.(Not); ok {
+		problems = append(problems, "query only excludes terms, so it matches every other file")
+	}
+
+	return problems
+}
+
+// terms returns all terms in an expression.
+func terms(expr Expr) []Term {
+	switch e := expr.(type) {
+	case Term:
+		return []Term{e}
+	case Not:
+		return terms(e.Expr)
+	case And:
+		var all []Term
+		for _, sub := range e {
+			all = append(all, terms(sub)...)
+		}
+		return all
+	case Or:
+		var all []Term
+		for _, sub := range e {
+			all = append(all, terms(sub)...)
+		}
+		return all
+	}
+	return nil
+}
@@ -0,0 +1,382 @@
+package localsearch
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Query is a parsed Gitlab advanced search query: an expression matched
+// against the contents of a file, and filters on its path. Filters only
+// apply at the top level of a query, like in Gitlab.
+type Query struct {
+	// Expr is nil for queries with only filters.
+	Expr    Expr
+	Filters []Filter
+}
+
+// Expr is a node in the syntax tree of a query.
+type Expr interface {
+	String() string
+}
+
+// Term matches files containing the text, case insensitively. Phrase is true
+// for quoted terms; a phrase matches exactly, a term may end with * to match
+// any word starting with it.
+type Term struct {
+	Text   string
+	Phrase bool
+}
+
+// And matches files matching all expressions; terms separated by whitespace.
+type And []Expr
+
+// Or matches files matching any of the expressions; terms separated by |.
+type Or []Expr
+
+// Not matches files not matching the expression; a term prefixed with -.
+type Not struct {
+	Expr Expr
+}
+
+// Filter is a filter on the path of a file, e.g. extension:html. A negated
+// filter, e.g. -extension:spec.ts, excludes the files it matches.
+type Filter struct {
+	Name    string
+	Value   string
+	Negated bool
+}
+
+func (t Term) String() string {
+	if t.Phrase {
+		return fmt.Sprintf("%q", t.Text)
+	}
+	return t.Text
+}
+
+func (a And) String() string { return "(" + joinExprs(a, " ") + ")" }
+func (o Or) String() string  { return "(" + joinExprs(o, " | ") + ")" }
+func (n Not) String() string { return "-" + n.Expr.String() }
+
+func (f Filter) String() string {
+	if f.Negated {
+		return "-" + f.Name + ":" + f.Value
+	}
+	return f.Name + ":" + f.Value
+}
+
+func joinExprs(exprs []Expr, sep string) string {
+	s := make([]string, len(exprs))
+	for i, e := range exprs {
+		s[i] = e.String()
+	}
+	return strings.Join(s, sep)
+}
+
+// filters are the Gitlab search filters, and whether they are supported.
+var filters = map[string]bool{
+	"extension": true,
+	"filename":  true,
+	"path":      true,
+	"blob":      false,
+}
+
+// Parse parses a query in Gitlab's advanced search syntax:
+// https://docs.gitlab.com/user/search/advanced_search/#syntax
+//
+// Terms separated by whitespace must all match, | separates alternatives,
+// - excludes a term, parentheses group terms and double quotes make a phrase,
+// in which \" is a literal quote. The extension:, filename: and path: filters
+// are supported, and can be negated with -; repeated filters of the same name
+// are alternatives.
+func Parse(query string) (*Query, error) {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{query: query, tokens: tokens}
+	q := &Query{}
+
+	// filters are taken out of the top level of the query first, since they
+	// apply to the whole query wherever they are.
+	var rest []token
+	depth := 0
+	for i := 0; i < len(p.tokens); i++ {
+		t := p.tokens[i]
+		switch t.kind {
+		case tokenOpen:
+			depth++
+		case tokenClose:
+			depth--
+		}
+
+		negated := false
+		if t.kind == tokenNot && i+1 < len(p.tokens) {
+			negated = true
+			t = p.tokens[i+1]
+		}
+
+		name, value, ok := t.filter()
+		if !ok || depth > 0 {
+			rest = append(rest, p.tokens[i])
+			continue
+		}
+
+		if negated {
+			i++
+		}
+
+		if !filters[name] {
+			return nil, fmt.Errorf("unsupported filter %s: in query %q", name, query)
+		}
+		if value == "" {
+			return nil, fmt.Errorf("empty filter %s: in query %q", name, query)
+		}
+		q.Filters = append(q.Filters, Filter{Name: name, Value: value, Negated: negated})
+	}
+
+	p.tokens = rest
+	if len(p.tokens) > 0 {
+		if q.Expr, err = p.parseOr(); err != nil {
+			return nil, err
+		}
+		if p.pos < len(p.tokens) {
+			return nil, p.errorf("unbalanced parentheses")
+		}
+	}
+
+	if q.Expr == nil && len(q.Filters) == 0 {
+		return nil, fmt.Errorf("query %q has no search terms", query)
+	}
+
+	return q, nil
+}
+
+type tokenKind int
+
+const (
+	tokenTerm tokenKind = iota
+	tokenPhrase
+	tokenOr
+	tokenNot
+	tokenOpen
+	tokenClose
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	// joined is true if the token directly follows the previous one, without
+	// whitespace in between.
+	joined bool
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenPhrase:
+		return fmt.Sprintf("%q", t.text)
+	case tokenTerm:
+		return fmt.Sprintf("term %q", t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// filter returns the name and value of a filter token, e.g. extension:html.
+func (t token) filter() (name string, value string, ok bool) {
+	if t.kind != tokenTerm {
+		return "", "", false
+	}
+
+	name, value, found := strings.Cut(t.text, ":")
+	if _, known := filters[name]; !found || !known {
+		return "", "", false
+	}
+
+	return name, value, true
+}
+
+// tokenize splits a query into terms, phrases and operators. A - is only an
+// operator at the start of a term, so e.g. btn-primary is a single term.
+// Backslash escapes the next character, e.g. class=\"btn is a term
+// containing a quote.
+func tokenize(query string) ([]token, error) {
+	var tokens []token
+	var current strings.Builder
+	inQuotes, escaped, joined := false, false, false
+
+	emit := func(t token) {
+		t.joined = joined
+		tokens = append(tokens, t)
+		joined = true
+	}
+
+	flush := func() {
+		if current.Len() > 0 {
+			emit(token{kind: tokenTerm, text: current.String()})
+		}
+		current.Reset()
+	}
+
+	for _, r := range query {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"' && inQuotes:
+			emit(token{kind: tokenPhrase, text: current.String()})
+			current.Reset()
+			inQuotes = false
+		case inQuotes:
+			current.WriteRune(r)
+		case r == '"':
+			flush()
+			inQuotes = true
+		case r == ' ' || r == '\t' || r == '\n':
+			flush()
+			joined = false
+		case r == '|':
+			flush()
+			emit(token{kind: tokenOr, text: "|"})
+		case r == '(':
+			flush()
+			emit(token{kind: tokenOpen, text: "("})
+		case r == ')':
+			flush()
+			emit(token{kind: tokenClose, text: ")"})
+		case r == '-' && current.Len() == 0:
+			emit(token{kind: tokenNot, text: "-"})
+		default:
+			current.WriteRune(r)
+		}
+	}
+
+	if inQuotes {
+		return nil, fmt.Errorf("unbalanced quotes in query %q", query)
+	}
+	if escaped {
+		return nil, fmt.Errorf("query %q ends with an escape character", query)
+	}
+	flush()
+
+	return tokens, nil
+}
+
+// parser is a recursive descent parser for the grammar:
+//
+//	or      = and { "|" and }
+//	and     = unary { unary }
+//	unary   = "-" unary | primary
+//	primary = "(" or ")" | term | phrase
+type parser struct {
+	query  string
+	tokens []token
+	pos    int
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%s in query %q", fmt.Sprintf(format, args...), p.query)
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	var alternatives Or
+	for {
+		expr, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		alternatives = append(alternatives, expr)
+
+		if t, ok := p.peek(); !ok || t.kind != tokenOr {
+			break
+		}
+		p.pos++
+	}
+
+	if len(alternatives) == 1 {
+		return alternatives[0], nil
+	}
+	return alternatives, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	var all And
+	for {
+		t, ok := p.peek()
+		if !ok || t.kind == tokenOr || t.kind == tokenClose {
+			break
+		}
+
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, expr)
+	}
+
+	switch len(all) {
+	case 0:
+		if t, ok := p.peek(); ok {
+			return nil, p.errorf("missing term before %s", t)
+		}
+		return nil, p.errorf("missing term at the end")
+	case 1:
+		return all[0], nil
+	}
+	return all, nil
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	if t, _ := p.peek(); t.kind == tokenNot {
+		p.pos++
+		if _, ok := p.peek(); !ok {
+			return nil, p.errorf("missing term after -")
+		}
+
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return Not{Expr: expr}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	t, _ := p.peek()
+	p.pos++
+
+	switch t.kind {
+	case tokenOpen:
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t, ok := p.peek(); !ok || t.kind != tokenClose {
+			return nil, p.errorf("unbalanced parentheses")
+		}
+		p.pos++
+		return expr, nil
+	case tokenTerm:
+		if _, _, ok := t.filter(); ok {
+			return nil, p.errorf("filter %s can only be used at the top level", t.text)
+		}
+		return Term{Text: t.text}, nil
+	case tokenPhrase:
+		if t.text == "" {
+			return nil, p.errorf("empty phrase")
+		}
+		return Term{Text: t.text, Phrase: true}, nil
+	}
+
+	return nil, p.errorf("unexpected %s", t)
+}
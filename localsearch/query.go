@@ -0,0 +1,146 @@
+package localsearch
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Matcher decides whether a file matches a search query.
+type Matcher interface {
+	// MatchPath returns whether a file with this path can match at all, e.g.
+	// based on its extension, so files can be skipped without reading them.
+	MatchPath(path string) bool
+	// Match returns whether the file matches and the 1-based line number of
+	// the first match, or 0 if it doesn't match.
+	Match(path string, content []byte) (line int, ok bool)
+}
+
+// Compile parses a search query in Gitlab's advanced search syntax into a
+// Matcher, see Parse for the supported syntax.
+//
+// Gitlab matches terms against the words in a file as split by
+// Elasticsearch; the matcher approximates that by looking for the terms
+// anywhere in the file, case insensitively.
+func Compile(query string) (Matcher, error) {
+	q, err := Parse(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return &queryMatcher{query: q}, nil
+}
+
+type queryMatcher struct {
+	query *Query
+}
+
+// MatchPath matches the filters: a path must match one of the filters of each
+// name, e.g. either of extension:ts extension:tsx, and none of the negated
+// filters.
+func (m *queryMatcher) MatchPath(filePath string) bool {
+	matched := make(map[string]bool)
+	for _, f := range m.query.Filters {
+		switch {
+		case f.Negated && f.matchPath(filePath):
+			return false
+		case !f.Negated:
+			matched[f.Name] = matched[f.Name] || f.matchPath(filePath)
+		}
+	}
+
+	for _, ok := range matched {
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *queryMatcher) Match(filePath string, content []byte) (int, bool) {
+	if !m.MatchPath(filePath) {
+		return 0, false
+	}
+
+	if m.query.Expr == nil {
+		return 1, true
+	}
+
+	lower := bytes.ToLower(content)
+	ok, first := eval(m.query.Expr, lower)
+	if !ok {
+		return 0, false
+	}
+
+	// a file can match only because it doesn't contain something, which has
+	// no line to point to.
+	if first < 0 {
+		return 1, true
+	}
+
+	return bytes.Count(lower[:first], []byte("\n")) + 1, true
+}
+
+// eval returns whether the lowercased content matches the expression, and
+// the offset of the first matching term, or -1 if the match isn't caused by
+// a term being present, e.g. for -term.
+func eval(expr Expr, lower []byte) (bool, int) {
+	switch e := expr.(type) {
+	case Term:
+		text := strings.ToLower(e.Text)
+		if !e.Phrase {
+			text = strings.TrimSuffix(text, "*")
+		}
+		i := bytes.Index(lower, []byte(text))
+		return i >= 0, i
+	case Not:
+		ok, _ := eval(e.Expr, lower)
+		return !ok, -1
+	case And:
+		first := -1
+		for _, sub := range e {
+			ok, i := eval(sub, lower)
+			if !ok {
+				return false, -1
+			}
+			first = earliest(first, i)
+		}
+		return true, first
+	case Or:
+		matched, first := false, -1
+		for _, sub := range e {
+			if ok, i := eval(sub, lower); ok {
+				matched = true
+				first = earliest(first, i)
+			}
+		}
+		return matched, first
+	}
+
+	panic(fmt.Sprintf("unknown expression %T", expr))
+}
+
+// earliest returns the lowest offset of a and b, ignoring -1.
+func earliest(a, b int) int {
+	if a < 0 || (b >= 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// matchPath returns whether the path matches the filter, ignoring Negated.
+// Like in Gitlab, extension: matches the extension exactly, filename: the
+// file name with * as wildcard, and path: any part of the directory.
+func (f Filter) matchPath(filePath string) bool {
+	switch f.Name {
+	case "extension":
+		return strings.EqualFold(strings.TrimPrefix(path.Ext(filePath), "."), strings.TrimPrefix(f.Value, "."))
+	case "filename":
+		ok, _ := path.Match(strings.ToLower(f.Value), strings.ToLower(path.Base(filePath)))
+		return ok
+	case "path":
+		return strings.Contains(strings.ToLower(path.Dir(filePath))+"/", strings.ToLower(strings.Trim(f.Value, "/*")))
+	}
+	return false
+}
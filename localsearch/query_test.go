@@ -0,0 +1,176 @@
+package localsearch_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fwielstra/crntmetrics/localsearch"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		query   string
+		expr    string
+		filters []localsearch.Filter
+	}{
+		{
+			query:   `"fa-icon" extension:html`,
+			expr:    `"fa-icon"`,
+			filters: []localsearch.Filter{{Name: "extension", Value: "html"}},
+		},
+		{
+			query:   `"<crnt-icon" -"crnt-icon-button" extension:html`,
+			expr:    `("<crnt-icon" -"crnt-icon-button")`,
+			filters: []localsearch.Filter{{Name: "extension", Value: "html"}},
+		},
+		{
+			query:   `class=\"btn btn-primary extension:html`,
+			expr:    `(class="btn btn-primary)`,
+			filters: []localsearch.Filter{{Name: "extension", Value: "html"}},
+		},
+		{
+			query:   `class=\""btn btn-secondary" extension:html`,
+			expr:    `(class=" "btn btn-secondary")`,
+			filters: []localsearch.Filter{{Name: "extension", Value: "html"}},
+		},
+		{
+			query:   `("crnt-button" | "crnt-button-alt") variant=\"primary\" extension:html`,
+			expr:    `(("crnt-button" | "crnt-button-alt") variant="primary")`,
+			filters: []localsearch.Filter{{Name: "extension", Value: "html"}},
+		},
+		{
+			query:   `"import { Icon } from \"@essent/themes\"" extension:tsx`,
+			expr:    `"import { Icon } from \"@essent/themes\""`,
+			filters: []localsearch.Filter{{Name: "extension", Value: "tsx"}},
+		},
+		{
+			query: `a b | c -(d | e)`,
+			expr:  `((a b) | (c -(d | e)))`,
+		},
+		{
+			query:   `Button -extension:spec.tsx filename:*.tsx path:src/`,
+			expr:    `Button`,
+			filters: []localsearch.Filter{{Name: "extension", Value: "spec.tsx", Negated: true}, {Name: "filename", Value: "*.tsx"}, {Name: "path", Value: "src/"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := localsearch.Parse(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := q.Expr.String(); got != tt.expr {
+				t.Errorf("expr = %s, want %s", got, tt.expr)
+			}
+			if !reflect.DeepEqual(q.Filters, tt.filters) {
+				t.Errorf("filters = %v, want %v", q.Filters, tt.filters)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		err   string
+	}{
+		{`"fa-icon extension:html`, "unbalanced quotes"},
+		{`(a | b c`, "unbalanced parentheses"},
+		{`a | b) c`, "unbalanced parentheses"},
+		{`a |`, "missing term"},
+		{`| a`, "missing term"},
+		{`a -`, "missing term after -"},
+		{`a ""`, "empty phrase"},
+		{`a blob:123`, "unsupported filter blob:"},
+		{`a extension:`, "empty filter extension:"},
+		{`(a extension:html)`, "only be used at the top level"},
+		{`a\`, "escape character"},
+		{``, "no search terms"},
+	}
+
+	for _, tt := range tests {
+		_, err := localsearch.Parse(tt.query)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Parse(%q) error = %v, want %q", tt.query, err, tt.err)
+		}
+	}
+}
+
+func TestCompileMatch(t *testing.T) {
+	tests := []struct {
+		query   string
+		path    string
+		content string
+		line    int
+	}{
+		// icon-web
+		{`"<crnt-icon" -"crnt-icon-button" extension:html`, "a.html", "<div>\n<crnt-icon name=\"x\">", 2},
+		{`"<crnt-icon" -"crnt-icon-button" extension:html`, "a.html", "<crnt-icon name=\"x\">\n<crnt-icon-button>", 0},
+		{`"<crnt-icon" -"crnt-icon-button" extension:html`, "a.ts", "<crnt-icon name=\"x\">", 0},
+		// primary-button-web
+		{`class=\"btn btn-primary extension:html`, "a.html", "<a class=\"btn btn-primary\">", 1},
+		{`class=\"btn btn-primary extension:html`, "a.html", "<a class=\"link\">btn-primary</a>", 0},
+		{`("crnt-button" | "crnt-button-alt") variant=\"primary\" extension:html`, "a.html", "\n<CRNT-BUTTON-ALT\n  variant=\"primary\">", 2},
+		{`("crnt-button" | "crnt-button-alt") variant=\"primary\" extension:html`, "a.html", "<crnt-button variant=\"secondary\">", 0},
+		// secondary-button-web
+		{`class=\""btn btn-secondary" extension:html`, "a.html", "<a class=\"btn btn-secondary\">", 1},
+		{`class=\""btn btn-secondary" extension:html`, "a.html", "<a class=\"btn btn-link btn-secondary\">", 0},
+		// icon-apps
+		{`"import { Icon } from \"@essent/themes\"" extension:tsx`, "a.tsx", "import { Icon } from \"@essent/themes\";", 1},
+		{`"import { Icon } from \"@essent/themes\"" extension:tsx`, "a.tsx", "import { Icon, Text } from \"@essent/themes\";", 0},
+		// other syntax
+		{`-deprecated extension:ts`, "a.ts", "current", 1},
+		{`crnt-* filename:*.component.html`, "src/a.component.html", "x\n<crnt-card>", 2},
+		{`crnt filename:*.component.html`, "src/a.html", "crnt", 0},
+		{`crnt path:src/app`, "src/app/a.html", "crnt", 1},
+		{`crnt path:src/app`, "lib/a.html", "crnt", 0},
+		{`crnt -extension:ts`, "a.ts", "crnt", 0},
+		// filters of the same name are alternatives, of different names all apply.
+		{`crnt extension:ts extension:tsx`, "a.tsx", "crnt", 1},
+		{`crnt extension:ts extension:tsx`, "a.html", "crnt", 0},
+		{`crnt extension:ts extension:tsx path:src`, "lib/a.ts", "crnt", 0},
+		{`crnt extension:ts extension:tsx -filename:*.spec.ts`, "src/a.spec.ts", "crnt", 0},
+	}
+
+	for _, tt := range tests {
+		m, err := localsearch.Compile(tt.query)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", tt.query, err)
+		}
+
+		line, ok := m.Match(tt.path, []byte(tt.content))
+		if line != tt.line || ok != (tt.line > 0) {
+			t.Errorf("Compile(%q).Match(%q, %q) = %d, %v, want %d", tt.query, tt.path, tt.content, line, ok, tt.line)
+		}
+	}
+}
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		query    string
+		problems []string
+	}{
+		{`"import { Icon } from \"@essent/themes\"" extension:tsx`, nil},
+		{`class=\"btn btn-primary extension:html`, nil},
+		{`class=\""btn btn-secondary" extension:html`, []string{`class=" and "btn btn-secondary" are searched as separate terms`}},
+		{`"fa-icon" ext:html`, []string{"unknown filter ext:"}},
+		{`-"fa-icon"`, []string{"only excludes terms"}},
+		{`extension:html`, []string{"only has filters"}},
+		{`"fa-icon extension:html`, []string{"unbalanced quotes"}},
+	}
+
+	for _, tt := range tests {
+		problems := localsearch.Lint(tt.query)
+		if len(problems) != len(tt.problems) {
+			t.Errorf("Lint(%q) = %q, want %q", tt.query, problems, tt.problems)
+			continue
+		}
+		for i, p := range problems {
+			if !strings.Contains(p, tt.problems[i]) {
+				t.Errorf("Lint(%q)[%d] = %q, want %q", tt.query, i, p, tt.problems[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,172 @@
+// Package localsearch counts search query matches in locally cloned
+// repositories, as an alternative to Gitlab's advanced search that works
+// offline and in CI.
+package localsearch
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/fwielstra/crntmetrics/domain"
+)
+
+// Repository is a local clone of a Gitlab project.
+type Repository struct {
+	ProjectID int
+	Tree      Tree
+	// Ref is reported as the ref of search results, e.g. the checked out branch.
+	Ref string
+}
+
+// NewRepository creates a Repository for the clone at dir, using the checked
+// out branch as ref if dir is a git repository.
+func NewRepository(projectID int, dir string) Repository {
+	return Repository{
+		ProjectID: projectID,
+		Tree:      DirTree(dir),
+		Ref:       currentBranch(dir),
+	}
+}
+
+// Searcher implements domain.Searcher by scanning local repositories. Group
+// and instance scopes search all repositories, since there is no way to tell
+// which group a local clone belongs to.
+type Searcher struct {
+	Repositories []Repository
+}
+
+func (s *Searcher) CountCode(ctx context.Context, query string, scope domain.Scope) (map[int]int, error) {
+	results, err := s.SearchCode(ctx, query, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	return domain.CountByProject(results), nil
+}
+
+func (s *Searcher) SearchCode(ctx context.Context, query string, scope domain.Scope) ([]*domain.SearchResult, error) {
+	matcher, err := Compile(query)
+	if err != nil {
+		return nil, err
+	}
+
+	repos, err := s.repositories(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*domain.SearchResult
+	for _, repo := range repos {
+		repoResults, err := Search(ctx, repo, matcher)
+		if err != nil {
+			return nil, fmt.Errorf("error searching project %d: %w", repo.ProjectID, err)
+		}
+		results = append(results, repoResults[0]...)
+	}
+
+	return results, nil
+}
+
+// repositories returns the repositories to search for the scope.
+func (s *Searcher) repositories(scope domain.Scope) ([]Repository, error) {
+	if scope.Instance || scope.Group != "" {
+		return s.Repositories, nil
+	}
+
+	repos := make([]Repository, 0, len(scope.ProjectIDs))
+	for _, id := range scope.ProjectIDs {
+		found := false
+		for _, repo := range s.Repositories {
+			if repo.ProjectID == id {
+				repos = append(repos, repo)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no local repository for project %d", id)
+		}
+	}
+
+	return repos, nil
+}
+
+// Search evaluates all matchers in a single walk over the repository, and
+// returns the results of each matcher ordered by path; a result for every
+// file that matches.
+func Search(ctx context.Context, repo Repository, matchers ...Matcher) ([][]*domain.SearchResult, error) {
+	results := make([][]*domain.SearchResult, len(matchers))
+
+	include := func(path string) bool {
+		for _, m := range matchers {
+			if m.MatchPath(path) {
+				return true
+			}
+		}
+		return false
+	}
+
+	err := repo.Tree.Walk(include, func(path string, content []byte) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		for i, matcher := range matchers {
+			line, ok := matcher.Match(path, content)
+			if !ok {
+				continue
+			}
+
+			results[i] = append(results[i], &domain.SearchResult{
+				ProjectID: repo.ProjectID,
+				Path:      path,
+				Ref:       repo.Ref,
+				StartLine: line,
+				Snippet:   lineAt(content, line),
+			})
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range results {
+		sort.Slice(r, func(i, j int) bool {
+			return r[i].Path < r[j].Path
+		})
+	}
+
+	return results, nil
+}
+
+// lineAt returns the 1-based line of content.
+func lineAt(content []byte, line int) string {
+	for i := 1; i < line; i++ {
+		next := bytes.IndexByte(content, '\n')
+		if next < 0 {
+			return ""
+		}
+		content = content[next+1:]
+	}
+
+	if end := bytes.IndexByte(content, '\n'); end >= 0 {
+		content = content[:end]
+	}
+
+	return strings.TrimRight(string(content), "\r")
+}
+
+// currentBranch returns the checked out branch of the git repository at dir,
+// or an empty string if it's not a git repository.
+func currentBranch(dir string) string {
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "--abbrev-ref", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,99 @@
+package localsearch_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fwielstra/crntmetrics/domain"
+	"github.com/fwielstra/crntmetrics/localsearch"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestSearcherCountCode(t *testing.T) {
+	web := writeFiles(t, map[string]string{
+		"src/app/header.html":          "<div>\n  <fa-icon name=\"x\"></fa-icon>\n</div>\n",
+		"src/app/footer.html":          "<FA-ICON></FA-ICON>",
+		"src/app/footer.ts":            "// fa-icon is not html",
+		"node_modules/lib/index.html":  "<fa-icon></fa-icon>",
+		"src/assets/icon.html":         "fa-icon\x00binary",
+		"src/app/crnt/crnt-icon.html":  "<crnt-icon></crnt-icon>",
+		"src/app/crnt/crnt-other.html": "<crnt-icon-button></crnt-icon-button>",
+	})
+	app := writeFiles(t, map[string]string{
+		"App.html": "<fa-icon></fa-icon>",
+	})
+
+	searcher := &localsearch.Searcher{
+		Repositories: []localsearch.Repository{
+			localsearch.NewRepository(62, web),
+			localsearch.NewRepository(3202, app),
+		},
+	}
+
+	counts, err := searcher.CountCode(context.Background(), `"fa-icon" extension:html`, domain.Scope{ProjectIDs: []int{62}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(counts) != 1 || counts[62] != 2 {
+		t.Errorf("expected 2 matches in project 62 only, got %v", counts)
+	}
+
+	counts, err = searcher.CountCode(context.Background(), `"fa-icon" extension:html`, domain.Scope{Instance: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if counts[62] != 2 || counts[3202] != 1 {
+		t.Errorf("expected matches in both projects, got %v", counts)
+	}
+}
+
+func TestSearcherSearchCode(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"src/header.html": "<div>\n  <fa-icon name=\"x\"></fa-icon>\n</div>\n",
+	})
+
+	searcher := &localsearch.Searcher{
+		Repositories: []localsearch.Repository{{ProjectID: 62, Tree: localsearch.DirTree(dir), Ref: "main"}},
+	}
+
+	results, err := searcher.SearchCode(context.Background(), `fa-icon`, domain.Scope{ProjectIDs: []int{62}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(results))
+	}
+
+	want := domain.SearchResult{ProjectID: 62, Path: "src/header.html", Ref: "main", StartLine: 2, Snippet: `  <fa-icon name="x"></fa-icon>`}
+	if *results[0] != want {
+		t.Errorf("expected %+v, got %+v", want, *results[0])
+	}
+}
+
+func TestSearcherUnknownProject(t *testing.T) {
+	searcher := &localsearch.Searcher{}
+
+	if _, err := searcher.CountCode(context.Background(), "fa-icon", domain.Scope{ProjectIDs: []int{62}}); err == nil {
+		t.Errorf("expected an error for a project without local repository")
+	}
+}
@@ -0,0 +1,100 @@
+package localsearch
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Files larger than this are skipped, like Gitlab's advanced search does by
+// default, so counts stay comparable.
+const maxFileSize = 1024 * 1024
+
+// directories that are never searched; they're not part of the repository
+// Gitlab indexes, but often present in a working copy.
+var skipDirs = map[string]bool{
+	".git":         true,
+	"node_modules": true,
+}
+
+// Tree is a set of files to search, e.g. the working tree of a clone or a
+// commit in its history.
+type Tree interface {
+	// Walk calls fn for every searchable file for which include returns true,
+	// with its slash separated path relative to the root of the tree and its
+	// contents. include is called before reading a file, so files that can't
+	// match are never read.
+	Walk(include func(path string) bool, fn func(path string, content []byte) error) error
+}
+
+// DirTree is a directory on disk, usually the working tree of a clone.
+type DirTree string
+
+func (d DirTree) Walk(include func(path string) bool, fn func(path string, content []byte) error) error {
+	root := string(d)
+
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			if path != root && skipDirs[entry.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if !include(rel) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() > maxFileSize {
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		if isBinary(content) {
+			return nil
+		}
+
+		return fn(rel, content)
+	})
+}
+
+// inSkippedDir returns whether a slash separated path is in one of the
+// skipDirs, at any depth.
+func inSkippedDir(path string) bool {
+	dirs := strings.Split(path, "/")
+	for _, dir := range dirs[:len(dirs)-1] {
+		if skipDirs[dir] {
+			return true
+		}
+	}
+	return false
+}
+
+// isBinary uses the same heuristic as git: a NUL byte in the first 8000 bytes.
+func isBinary(content []byte) bool {
+	return bytes.IndexByte(content[:min(len(content), 8000)], 0) >= 0
+}
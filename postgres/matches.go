@@ -0,0 +1,47 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/fwielstra/crntmetrics/domain"
+)
+
+func (s *Store) SaveMatches(matches []domain.Match) error {
+	return s.withTransaction(func(tx *sql.Tx) error {
+		stmt, err := tx.Prepare("INSERT INTO matches (run_id, timestamp, project_id, query, path, ref, start_line, snippet) VALUES ($1, $2, $3, $4, $5, $6, $7, $8);")
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, m := range matches {
+			if _, err := stmt.Exec(nullInt64(m.RunID), m.Timestamp, m.ProjectID, m.QueryName, m.Path, m.Ref, m.StartLine, m.Snippet); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Store) LoadLatestMatches(query string) ([]domain.Match, error) {
+	rows, err := s.db.Query(`SELECT COALESCE(run_id, 0), timestamp, project_id, query, path, COALESCE(ref, ''), COALESCE(start_line, 0), COALESCE(snippet, '')
+		FROM matches
+		WHERE query=$1 AND run_id = (SELECT id FROM runs WHERE details AND status IN ($2, $3) ORDER BY started_at DESC, id DESC LIMIT 1)
+		ORDER BY project_id ASC, path ASC, start_line ASC;`, query, domain.RunStatusSucceeded, domain.RunStatusPartial)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matches []domain.Match
+	for rows.Next() {
+		var m domain.Match
+		if err := rows.Scan(&m.RunID, &m.Timestamp, &m.ProjectID, &m.QueryName, &m.Path, &m.Ref, &m.StartLine, &m.Snippet); err != nil {
+			return nil, err
+		}
+		m.Timestamp = m.Timestamp.Local()
+		matches = append(matches, m)
+	}
+
+	return matches, rows.Err()
+}
@@ -0,0 +1,182 @@
+package postgres
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fwielstra/crntmetrics/domain"
+)
+
+// migrations are numbered sql files like the sqlite ones, but start from a
+// schema matching the latest sqlite one. Never edit a migration that has been
+// released, add a new one instead.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+const createMigrationsTable = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at TIMESTAMPTZ NOT NULL
+);
+`
+
+// migrationLock is the key of the advisory lock held while applying a
+// migration, so processes starting at the same time don't both apply it.
+const migrationLock = 7245350343
+
+type migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// migrations returns all migrations embedded in the binary, ordered by version.
+func migrations() ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]migration, 0, len(entries))
+	seen := make(map[int]string)
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".sql")
+		number, description, found := strings.Cut(name, "_")
+		version, err := strconv.Atoi(number)
+		if !found || err != nil {
+			return nil, fmt.Errorf("postgres.migrations(): invalid migration file name %s, expected <version>_<name>.sql", entry.Name())
+		}
+
+		if other, exists := seen[version]; exists {
+			return nil, fmt.Errorf("postgres.migrations(): duplicate migration version %d in %s and %s", version, other, entry.Name())
+		}
+		seen[version] = entry.Name()
+
+		contents, err := migrationFiles.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, migration{
+			Version: version,
+			Name:    description,
+			SQL:     string(contents),
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+
+	return result, nil
+}
+
+// Migrate applies all migrations that have not been applied yet. Each
+// migration runs in its own transaction together with its bookkeeping, so a
+// failing migration leaves the database at the previous version. Returns the
+// number of migrations applied.
+func (s *Store) Migrate() (int, error) {
+	statuses, err := s.MigrationStatuses()
+	if err != nil {
+		return 0, err
+	}
+
+	all, err := migrations()
+	if err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	for i, status := range statuses {
+		if status.Applied {
+			continue
+		}
+
+		m := all[i]
+		done := false
+		err := s.withTransaction(func(tx *sql.Tx) error {
+			if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1);", migrationLock); err != nil {
+				return err
+			}
+
+			// another process may have applied it while waiting for the lock.
+			if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version=$1);", m.Version).Scan(&done); err != nil || done {
+				return err
+			}
+
+			log.Printf("applying migration %d %s", m.Version, m.Name)
+
+			if _, err := tx.Exec(m.SQL); err != nil {
+				return err
+			}
+
+			_, err := tx.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3);", m.Version, m.Name, time.Now())
+			return err
+		})
+
+		if err != nil {
+			return applied, fmt.Errorf("postgres.Migrate(): error applying migration %d %s: %w", m.Version, m.Name, err)
+		}
+
+		if !done {
+			applied++
+		}
+	}
+
+	return applied, nil
+}
+
+// MigrationStatuses returns all known migrations and whether they have been applied.
+func (s *Store) MigrationStatuses() ([]domain.MigrationStatus, error) {
+	if _, err := s.db.Exec(createMigrationsTable); err != nil {
+		return nil, fmt.Errorf("postgres.MigrationStatuses(): error creating migrations table: %w", err)
+	}
+
+	all, err := migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query("SELECT version, applied_at FROM schema_migrations;")
+	if err != nil {
+		return nil, fmt.Errorf("postgres.MigrationStatuses(): error loading applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	appliedAt := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		appliedAt[version] = at.Local()
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]domain.MigrationStatus, len(all))
+	for i, m := range all {
+		at, applied := appliedAt[m.Version]
+		statuses[i] = domain.MigrationStatus{
+			Version:   m.Version,
+			Name:      m.Name,
+			Applied:   applied,
+			AppliedAt: at,
+		}
+	}
+
+	return statuses, nil
+}
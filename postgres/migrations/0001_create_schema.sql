@@ -0,0 +1,47 @@
+-- the schema of the sqlite migrations up to 0005, in one go, with native
+-- timestamps instead of unix milliseconds.
+CREATE TABLE runs (
+	id BIGSERIAL PRIMARY KEY,
+	started_at TIMESTAMPTZ NOT NULL,
+	finished_at TIMESTAMPTZ,
+	gitlab_url TEXT,
+	config_hash TEXT,
+	tool_version TEXT,
+	status TEXT NOT NULL,
+	error_count INTEGER NOT NULL DEFAULT 0,
+	errors JSONB
+);
+
+CREATE TABLE results (
+	run_id BIGINT REFERENCES runs(id),
+	timestamp TIMESTAMPTZ NOT NULL,
+	project_id BIGINT NOT NULL,
+	query TEXT NOT NULL,
+	old_results INTEGER NOT NULL,
+	crnt_results INTEGER NOT NULL,
+	commit_sha TEXT
+);
+
+CREATE INDEX results_query_timestamp ON results (query, timestamp);
+CREATE INDEX results_run ON results (run_id);
+CREATE INDEX results_project_commit ON results (project_id, commit_sha);
+
+CREATE TABLE projects (
+	id BIGINT PRIMARY KEY,
+	name TEXT NOT NULL,
+	namespace TEXT,
+	url TEXT
+);
+
+CREATE TABLE matches (
+	run_id BIGINT REFERENCES runs(id),
+	timestamp TIMESTAMPTZ NOT NULL,
+	project_id BIGINT NOT NULL,
+	query TEXT NOT NULL,
+	path TEXT NOT NULL,
+	ref TEXT,
+	start_line INTEGER,
+	snippet TEXT
+);
+
+CREATE INDEX matches_query_run ON matches (query, run_id);
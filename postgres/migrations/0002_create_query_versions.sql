@@ -0,0 +1,14 @@
+-- every distinct definition of a query pair, identified by a hash of its
+-- scope and queries, and the version each result was measured with, so a
+-- change to a query can be told apart from a change in usages.
+CREATE TABLE query_versions (
+	query TEXT NOT NULL,
+	hash TEXT NOT NULL,
+	scope JSONB NOT NULL,
+	old TEXT NOT NULL,
+	crnt TEXT NOT NULL,
+	valid_from TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (query, hash)
+);
+
+ALTER TABLE results ADD COLUMN query_hash TEXT;
@@ -0,0 +1,189 @@
+package postgres
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/fwielstra/crntmetrics/domain"
+)
+
+// the columns to select to scan a result with scanResults.
+const resultColumns = "COALESCE(run_id, 0), timestamp, project_id, query, old_results, crnt_results, COALESCE(commit_sha, ''), COALESCE(query_hash, '')"
+
+func (s *Store) SaveResults(results []domain.ResultRow) error {
+	return s.withTransaction(func(tx *sql.Tx) error {
+		stmt, err := tx.Prepare("INSERT INTO results (run_id, timestamp, project_id, query, old_results, crnt_results, commit_sha, query_hash) VALUES ($1, $2, $3, $4, $5, $6, $7, $8);")
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, res := range results {
+			if _, err := stmt.Exec(nullInt64(res.RunID), res.Timestamp, res.ProjectID, res.QueryName, res.OldResults, res.CrntResults, nullString(res.CommitSHA), nullString(res.QueryHash)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// importResults saves the results that don't exist yet, identified by their
+// timestamp, project and query, and returns how many were saved.
+func importResults(tx *sql.Tx, results []domain.ResultRow) (int, error) {
+	imported := 0
+	stmt, err := tx.Prepare(`INSERT INTO results (run_id, timestamp, project_id, query, old_results, crnt_results, commit_sha, query_hash)
+		SELECT $1, $2, $3, $4, $5, $6, $7, $8
+		WHERE NOT EXISTS (SELECT 1 FROM results WHERE timestamp=$2 AND project_id=$3 AND query=$4);`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	for _, res := range results {
+		inserted, err := stmt.Exec(nullInt64(res.RunID), res.Timestamp, res.ProjectID, res.QueryName, res.OldResults, res.CrntResults, nullString(res.CommitSHA), nullString(res.QueryHash))
+		if err != nil {
+			return 0, err
+		}
+
+		n, err := inserted.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		imported += int(n)
+	}
+
+	return imported, nil
+}
+
+func (s *Store) LoadResults() ([]domain.ResultRow, error) {
+	rows, err := s.db.Query("SELECT " + resultColumns + " FROM results ORDER BY timestamp ASC;")
+	if err != nil {
+		return nil, err
+	}
+
+	return scanResults(rows)
+}
+
+func (s *Store) LoadQueryResults(query string) ([]domain.ResultRow, error) {
+	return s.LoadQueryResultsBetween(query, time.Time{}, time.Time{})
+}
+
+func (s *Store) LoadQueryResultsBetween(query string, from time.Time, to time.Time) ([]domain.ResultRow, error) {
+	stmt := "SELECT " + resultColumns + " FROM results WHERE query=$1"
+	args := []any{query}
+
+	if !from.IsZero() {
+		args = append(args, from)
+		stmt += " AND timestamp >= $" + strconv.Itoa(len(args))
+	}
+	if !to.IsZero() {
+		args = append(args, to)
+		stmt += " AND timestamp <= $" + strconv.Itoa(len(args))
+	}
+
+	rows, err := s.db.Query(stmt+" ORDER BY timestamp ASC;", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanResults(rows)
+}
+
+func (s *Store) LoadLatestResults() ([]domain.ResultRow, error) {
+	rows, err := s.db.Query("SELECT " + resultColumns + " FROM results r WHERE timestamp = (SELECT MAX(timestamp) FROM results WHERE query = r.query) ORDER BY query ASC, project_id ASC;")
+	if err != nil {
+		return nil, err
+	}
+
+	return scanResults(rows)
+}
+
+func (s *Store) LoadRunResults(runID int64) ([]domain.ResultRow, error) {
+	rows, err := s.db.Query("SELECT "+resultColumns+" FROM results WHERE run_id=$1 ORDER BY query ASC, project_id ASC;", runID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanResults(rows)
+}
+
+// scanResults reads all rows selected with resultColumns and closes them.
+func scanResults(rows *sql.Rows) ([]domain.ResultRow, error) {
+	defer rows.Close()
+
+	var results []domain.ResultRow
+	for rows.Next() {
+		var res domain.ResultRow
+		if err := rows.Scan(&res.RunID, &res.Timestamp, &res.ProjectID, &res.QueryName, &res.OldResults, &res.CrntResults, &res.CommitSHA, &res.QueryHash); err != nil {
+			return nil, err
+		}
+		res.Timestamp = res.Timestamp.Local()
+		results = append(results, res)
+	}
+
+	return results, rows.Err()
+}
+
+func (s *Store) LoadBackfilledTimes(projectID int) (map[int64]map[string]bool, error) {
+	rows, err := s.db.Query("SELECT DISTINCT timestamp, query FROM results WHERE project_id=$1 AND commit_sha IS NOT NULL;", projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	times := make(map[int64]map[string]bool)
+	for rows.Next() {
+		var ts time.Time
+		var query string
+		if err := rows.Scan(&ts, &query); err != nil {
+			return nil, err
+		}
+		key := ts.UnixMilli()
+		if times[key] == nil {
+			times[key] = make(map[string]bool)
+		}
+		times[key][query] = true
+	}
+
+	return times, rows.Err()
+}
+
+func (s *Store) LoadFirstUpdateTimes(projectID int) (map[string]time.Time, error) {
+	rows, err := s.db.Query("SELECT query, MIN(timestamp) FROM results WHERE project_id=$1 AND commit_sha IS NULL GROUP BY query;", projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	times := make(map[string]time.Time)
+	for rows.Next() {
+		var query string
+		var ts time.Time
+		if err := rows.Scan(&query, &ts); err != nil {
+			return nil, err
+		}
+		times[query] = ts.Local()
+	}
+
+	return times, rows.Err()
+}
+
+func (s *Store) LoadQueryNames() ([]string, error) {
+	rows, err := s.db.Query("SELECT DISTINCT query FROM results ORDER BY query ASC;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
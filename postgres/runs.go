@@ -0,0 +1,169 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/fwielstra/crntmetrics/domain"
+)
+
+const runColumns = "id, started_at, finished_at, COALESCE(gitlab_url, ''), COALESCE(config_hash, ''), COALESCE(tool_version, ''), details, status, error_count, COALESCE(errors::text, '')"
+
+func (s *Store) StartRun(run *domain.Run) error {
+	err := s.db.QueryRow("INSERT INTO runs (started_at, gitlab_url, config_hash, tool_version, details, status) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id;",
+		run.StartedAt, run.GitlabURL, run.ConfigHash, run.ToolVersion, run.Details, run.Status).Scan(&run.ID)
+	if err != nil {
+		return fmt.Errorf("postgres.StartRun(): error inserting run: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) FinishRun(run *domain.Run) error {
+	// errors are stored as a JSON array, error messages can span multiple lines.
+	errs, err := json.Marshal(run.Errors)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec("UPDATE runs SET finished_at=$1, status=$2, error_count=$3, errors=$4 WHERE id=$5;",
+		run.FinishedAt, run.Status, run.ErrorCount, string(errs), run.ID)
+	if err != nil {
+		return fmt.Errorf("postgres.FinishRun(): error updating run %d: %w", run.ID, err)
+	}
+
+	return nil
+}
+
+// importRun saves a run from another database with its ID in this one, or
+// sets the ID of the run that started at the same time on the same Gitlab.
+// Returns whether the run was saved.
+func importRun(tx *sql.Tx, run *domain.Run) (bool, error) {
+	err := tx.QueryRow("SELECT id FROM runs WHERE started_at=$1 AND COALESCE(gitlab_url, '')=$2;", run.StartedAt, run.GitlabURL).Scan(&run.ID)
+	if err == nil {
+		return false, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+
+	var finishedAt sql.NullTime
+	var errs sql.NullString
+	if !run.FinishedAt.IsZero() {
+		encoded, err := json.Marshal(run.Errors)
+		if err != nil {
+			return false, err
+		}
+		finishedAt = sql.NullTime{Time: run.FinishedAt, Valid: true}
+		errs = sql.NullString{String: string(encoded), Valid: true}
+	}
+
+	err = tx.QueryRow("INSERT INTO runs (started_at, finished_at, gitlab_url, config_hash, tool_version, details, status, error_count, errors) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id;",
+		run.StartedAt, finishedAt, run.GitlabURL, run.ConfigHash, run.ToolVersion, run.Details, run.Status, run.ErrorCount, errs).Scan(&run.ID)
+	if err != nil {
+		return false, fmt.Errorf("error inserting run: %w", err)
+	}
+
+	return true, nil
+}
+
+func (s *Store) LoadRuns(limit int) ([]domain.Run, error) {
+	rows, err := s.db.Query("SELECT "+runColumns+" FROM runs ORDER BY started_at DESC, id DESC LIMIT $1;", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []domain.Run
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, rows.Err()
+}
+
+func (s *Store) LoadRun(id int64) (domain.Run, error) {
+	row := s.db.QueryRow("SELECT "+runColumns+" FROM runs WHERE id=$1;", id)
+
+	run, err := scanRun(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return run, fmt.Errorf("%w: %d", domain.ErrRunNotFound, id)
+	}
+
+	return run, err
+}
+
+func (s *Store) LoadLatestUpdateRun() (domain.Run, error) {
+	row := s.db.QueryRow("SELECT " + runColumns + ` FROM runs WHERE gitlab_url IS NULL OR gitlab_url NOT LIKE 'backfill:%'
+		ORDER BY started_at DESC, id DESC LIMIT 1;`)
+
+	run, err := scanRun(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return run, domain.ErrRunNotFound
+	}
+
+	return run, err
+}
+
+// both sql.Row and sql.Rows implement this
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRun(row scanner) (domain.Run, error) {
+	var run domain.Run
+	var finishedAt sql.NullTime
+	var errs string
+
+	if err := row.Scan(&run.ID, &run.StartedAt, &finishedAt, &run.GitlabURL, &run.ConfigHash, &run.ToolVersion, &run.Details, &run.Status, &run.ErrorCount, &errs); err != nil {
+		return run, err
+	}
+
+	run.StartedAt = run.StartedAt.Local()
+	if finishedAt.Valid {
+		run.FinishedAt = finishedAt.Time.Local()
+	}
+	if errs != "" {
+		if err := json.Unmarshal([]byte(errs), &run.Errors); err != nil {
+			return run, fmt.Errorf("error decoding errors of run %d: %w", run.ID, err)
+		}
+	}
+
+	return run, nil
+}
+
+func (s *Store) LoadRunCounts() (domain.RunCounts, error) {
+	counts := domain.RunCounts{Runs: make(map[domain.RunStatus]int)}
+
+	rows, err := s.db.Query(`SELECT status, COUNT(*),
+		SUM(CASE WHEN gitlab_url LIKE 'local:%' OR gitlab_url LIKE 'backfill:%' THEN 0 ELSE error_count END),
+		MAX(finished_at)
+		FROM runs GROUP BY status;`)
+	if err != nil {
+		return counts, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var status domain.RunStatus
+		var runs, errs int
+		var finishedAt sql.NullTime
+		if err := rows.Scan(&status, &runs, &errs, &finishedAt); err != nil {
+			return counts, err
+		}
+
+		counts.Runs[status] = runs
+		counts.GitlabErrors += errs
+		if finishedAt.Valid && finishedAt.Time.After(counts.LastFinishedAt) {
+			counts.LastFinishedAt = finishedAt.Time.Local()
+		}
+	}
+
+	return counts, rows.Err()
+}
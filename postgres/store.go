@@ -0,0 +1,110 @@
+// Package postgres stores results in a PostgreSQL database, for running on a
+// platform without persistent local disks.
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/fwielstra/crntmetrics/domain"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// Store implements domain.Storage on a PostgreSQL database.
+type Store struct {
+	db *sql.DB
+}
+
+var _ domain.Storage = (*Store)(nil)
+
+// Open connects to the database at dsn, a postgres:// URL or a key=value
+// connection string.
+func Open(dsn string) (*Store, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("postgres.Open(): error opening database: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("postgres.Open(): error connecting to database: %w", err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// utility function to wrap a load of operations in a tx
+func (s *Store) withTransaction(cb func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := cb(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// nullInt64 stores zero IDs as NULL.
+func nullInt64(v int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: v, Valid: v != 0}
+}
+
+// nullString stores empty strings as NULL.
+func nullString(v string) sql.NullString {
+	return sql.NullString{String: v, Valid: v != ""}
+}
+
+// Reset moves all tables into a timestamped backup schema, where they can be
+// queried or moved back if needed.
+func (s *Store) Reset() (string, error) {
+	backup := "crntmetrics_backup_" + time.Now().Format("20060102_150405")
+
+	err := s.withTransaction(func(tx *sql.Tx) error {
+		rows, err := tx.Query("SELECT tablename FROM pg_tables WHERE schemaname = current_schema();")
+		if err != nil {
+			return err
+		}
+
+		var tables []string
+		for rows.Next() {
+			var table string
+			if err := rows.Scan(&table); err != nil {
+				rows.Close()
+				return err
+			}
+			tables = append(tables, table)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec("CREATE SCHEMA " + backup + ";"); err != nil {
+			return err
+		}
+
+		// sequences and indexes move along with their tables.
+		for _, table := range tables {
+			if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %q SET SCHEMA %s;", table, backup)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("postgres.Reset(): error moving tables to schema %s: %w", backup, err)
+	}
+
+	return "schema " + backup, nil
+}
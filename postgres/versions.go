@@ -0,0 +1,62 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/fwielstra/crntmetrics/domain"
+)
+
+// SaveQueryVersions inserts the versions that don't exist yet; for existing
+// ones, the earliest valid from is kept.
+func (s *Store) SaveQueryVersions(versions []domain.QueryVersion) error {
+	return s.withTransaction(func(tx *sql.Tx) error {
+		return saveQueryVersions(tx, versions)
+	})
+}
+
+func saveQueryVersions(tx *sql.Tx, versions []domain.QueryVersion) error {
+	stmt, err := tx.Prepare(`INSERT INTO query_versions (query, hash, scope, old, crnt, valid_from) VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (query, hash) DO UPDATE SET valid_from = LEAST(query_versions.valid_from, excluded.valid_from);`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, v := range versions {
+		scope, err := json.Marshal(v.Scope)
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.Exec(v.Query, v.Hash, string(scope), v.Old, v.Crnt, v.ValidFrom); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadQueryVersions loads the versions of all queries, ordered by query and
+// valid from.
+func (s *Store) LoadQueryVersions() ([]domain.QueryVersion, error) {
+	rows, err := s.db.Query("SELECT query, hash, scope::text, old, crnt, valid_from FROM query_versions ORDER BY query ASC, valid_from ASC;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []domain.QueryVersion
+	for rows.Next() {
+		var v domain.QueryVersion
+		var scope string
+		if err := rows.Scan(&v.Query, &v.Hash, &scope, &v.Old, &v.Crnt, &v.ValidFrom); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(scope), &v.Scope); err != nil {
+			return nil, err
+		}
+		v.ValidFrom = v.ValidFrom.Local()
+		versions = append(versions, v)
+	}
+
+	return versions, rows.Err()
+}
@@ -0,0 +1,160 @@
+// Package schedule runs a job periodically, at a fixed interval or on a cron
+// schedule.
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Schedule returns the next time to run after t.
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+// every runs at a fixed interval.
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+// Parse parses a schedule: either an interval like 6h, or a cron expression
+// like "0 6 * * 1-5" or a descriptor like @daily, in the local timezone.
+func Parse(spec string) (Schedule, error) {
+	if d, err := time.ParseDuration(spec); err == nil {
+		if d < time.Minute {
+			return nil, fmt.Errorf("invalid schedule %q, the interval must be at least a minute", spec)
+		}
+		return every(d), nil
+	}
+
+	s, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q, expected an interval like 6h or a cron expression: %w", spec, err)
+	}
+
+	return s, nil
+}
+
+// Status is the state of a scheduler, e.g. to show in a dashboard.
+type Status struct {
+	// Running is true while the job runs.
+	Running bool
+	// LastStart and LastFinish are zero until the job ran once.
+	LastStart  time.Time
+	LastFinish time.Time
+	// LastErr is the error of the last run.
+	LastErr error
+	// Next is the time the next run is planned, including jitter.
+	Next time.Time
+}
+
+// Scheduler runs a job on a schedule. Runs never overlap: a run that takes
+// longer than the schedule allows skips the runs it overlaps with.
+type Scheduler struct {
+	Schedule Schedule
+	// Jitter adds a random delay of up to Jitter to every run, so processes
+	// with the same schedule don't all hit Gitlab at the same time.
+	Jitter time.Duration
+	Job    func(ctx context.Context) error
+
+	mu     sync.Mutex
+	status Status
+	// planned is the time the last run was planned at, without jitter, so
+	// jitter doesn't add up over runs.
+	planned time.Time
+}
+
+// New creates a scheduler. last is when the job last started, e.g. in a
+// previous process; the first run is planned relative to it, so restarting
+// doesn't trigger an extra run, while a run that was missed when the process
+// wasn't running happens right away. A zero last runs the job right away.
+func New(schedule Schedule, jitter time.Duration, last time.Time, job func(ctx context.Context) error) *Scheduler {
+	return &Scheduler{
+		Schedule: schedule,
+		Jitter:   jitter,
+		Job:      job,
+		status:   Status{LastStart: last},
+		planned:  last,
+	}
+}
+
+// Status returns the current state of the scheduler.
+func (s *Scheduler) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// Run runs the job on the schedule until ctx is done. A running job gets the
+// same context, so it's cancelled as well; Run waits for it to return.
+func (s *Scheduler) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		next := s.next(time.Now())
+		log.Printf("next scheduled update at %s", next.Format(time.DateTime))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		s.run(ctx)
+	}
+}
+
+// next plans the next run after the last one, or right away if the run after
+// the last one was missed.
+func (s *Scheduler) next(now time.Time) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next := now
+	if !s.planned.IsZero() {
+		next = s.Schedule.Next(s.planned)
+		if next.Before(now) {
+			if s.status.LastFinish.IsZero() {
+				// missed while the process wasn't running.
+				next = now
+			} else {
+				log.Printf("the previous run took until %s, skipped the run at %s", s.status.LastFinish.Format(time.DateTime), next.Format(time.DateTime))
+				next = s.Schedule.Next(now)
+			}
+		}
+	}
+	s.planned = next
+
+	if s.Jitter > 0 {
+		next = next.Add(rand.N(s.Jitter))
+	}
+
+	s.status.Next = next
+	return next
+}
+
+func (s *Scheduler) run(ctx context.Context) {
+	s.mu.Lock()
+	s.status.Running = true
+	s.status.LastStart = time.Now()
+	s.mu.Unlock()
+
+	err := s.Job(ctx)
+	if err != nil {
+		log.Printf("scheduled update failed: %v", err)
+	}
+
+	s.mu.Lock()
+	s.status.Running = false
+	s.status.LastFinish = time.Now()
+	s.status.LastErr = err
+	s.mu.Unlock()
+}
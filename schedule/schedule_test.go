@@ -0,0 +1,128 @@
+package schedule
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func date(t *testing.T, value string) time.Time {
+	t.Helper()
+	ts, err := time.ParseInLocation(time.DateTime, value, time.Local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts
+}
+
+func TestParse(t *testing.T) {
+	from := date(t, "2025-06-18 12:30:00")
+
+	tests := []struct {
+		spec string
+		next string
+	}{
+		{"6h", "2025-06-18 18:30:00"},
+		{"0 6 * * 1-5", "2025-06-19 06:00:00"},
+		{"@daily", "2025-06-19 00:00:00"},
+		{"@weekly", "2025-06-22 00:00:00"},
+	}
+
+	for _, tt := range tests {
+		s, err := Parse(tt.spec)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.spec, err)
+		}
+		if got := s.Next(from); !got.Equal(date(t, tt.next)) {
+			t.Errorf("Parse(%q).Next() = %s, want %s", tt.spec, got, tt.next)
+		}
+	}
+
+	for _, spec := range []string{"", "10s", "tomorrow", "0 6 * *"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", spec)
+		}
+	}
+}
+
+func TestSchedulerNext(t *testing.T) {
+	now := date(t, "2025-06-18 12:00:00")
+
+	tests := []struct {
+		name       string
+		last       string
+		lastFinish string
+		want       string
+	}{
+		{"first run ever", "", "", "2025-06-18 12:00:00"},
+		{"after restart", "2025-06-18 10:00:00", "", "2025-06-18 16:00:00"},
+		{"missed while stopped", "2025-06-18 05:00:00", "", "2025-06-18 12:00:00"},
+		{"after a run", "2025-06-18 11:00:00", "2025-06-18 11:05:00", "2025-06-18 17:00:00"},
+		{"overran", "2025-06-18 05:00:00", "2025-06-18 12:00:00", "2025-06-18 18:00:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var last time.Time
+			if tt.last != "" {
+				last = date(t, tt.last)
+			}
+
+			s := New(every(6*time.Hour), 0, last, nil)
+			if tt.lastFinish != "" {
+				s.status.LastFinish = date(t, tt.lastFinish)
+			}
+
+			if got := s.next(now); !got.Equal(date(t, tt.want)) {
+				t.Errorf("next() = %s, want %s", got.Format(time.DateTime), tt.want)
+			}
+		})
+	}
+}
+
+func TestSchedulerJitter(t *testing.T) {
+	now := date(t, "2025-06-18 12:00:00")
+	s := New(every(time.Hour), 10*time.Minute, now.Add(-time.Hour), nil)
+
+	for range 10 {
+		next := s.next(now)
+		if next.Before(now) || !next.Before(now.Add(10*time.Minute)) {
+			t.Fatalf("next() = %s, want within 10 minutes of %s", next, now)
+		}
+		// jitter isn't carried over to the next run.
+		now = now.Add(time.Hour)
+	}
+}
+
+func TestSchedulerRunStops(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var runs atomic.Int32
+	s := New(every(time.Hour), 0, time.Time{}, func(ctx context.Context) error {
+		runs.Add(1)
+		// the running job is cancelled too, and Run waits for it.
+		cancel()
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run didn't stop after cancelling")
+	}
+
+	if runs.Load() != 1 {
+		t.Errorf("ran %d times, want 1", runs.Load())
+	}
+	if status := s.Status(); status.Running || status.LastErr != context.Canceled {
+		t.Errorf("status = %+v, want finished with context.Canceled", status)
+	}
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+)
+
+func (s *Server) handleAPIQueries(w http.ResponseWriter, r *http.Request) {
+	names, err := s.store.LoadQueryNames()
+	if err != nil {
+		apiError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, r, nonNil(names))
+}
+
+func (s *Server) handleAPIQueryResults(w http.ResponseWriter, r *http.Request) {
+	query := r.PathValue("name")
+
+	// a known query without results in the range returns [], an unknown one
+	// is an error, most likely a typo.
+	names, err := s.store.LoadQueryNames()
+	if err != nil {
+		apiError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	if !slices.Contains(names, query) {
+		apiError(w, r, http.StatusNotFound, fmt.Errorf("unknown query %q", query))
+		return
+	}
+
+	from, err := parseTime(r.URL.Query().Get("from"), false)
+	if err != nil {
+		apiError(w, r, http.StatusBadRequest, fmt.Errorf("invalid from: %w", err))
+		return
+	}
+
+	to, err := parseTime(r.URL.Query().Get("to"), true)
+	if err != nil {
+		apiError(w, r, http.StatusBadRequest, fmt.Errorf("invalid to: %w", err))
+		return
+	}
+
+	results, err := s.store.LoadQueryResultsBetween(query, from, to)
+	if err != nil {
+		apiError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, r, nonNil(results))
+}
+
+func (s *Server) handleAPIProjects(w http.ResponseWriter, r *http.Request) {
+	projects, err := s.store.LoadProjects()
+	if err != nil {
+		apiError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, r, nonNil(projects))
+}
+
+// parseTime parses an RFC 3339 timestamp or a plain date. A plain date used as
+// the end of a range includes that whole day. An empty value is the zero time.
+func parseTime(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected a date (2006-01-02) or RFC 3339 timestamp, got %q", value)
+	}
+
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Millisecond)
+	}
+
+	return t, nil
+}
+
+// nonNil makes sure empty results are encoded as [] instead of null.
+func nonNil[T any](values []T) []T {
+	if values == nil {
+		return []T{}
+	}
+	return values
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("%s %s: error encoding response: %v", r.Method, r.URL.Path, err)
+	}
+}
+
+func apiError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	message := err.Error()
+	if status >= http.StatusInternalServerError {
+		log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+		message = http.StatusText(status)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
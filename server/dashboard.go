@@ -0,0 +1,197 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/fwielstra/crntmetrics/chart"
+	"github.com/fwielstra/crntmetrics/domain"
+	"github.com/fwielstra/crntmetrics/schedule"
+)
+
+var indexTemplate = template.Must(template.New("index").Funcs(template.FuncMap{
+	"datetime": func(t time.Time) string { return t.Format(time.DateTime) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>CRNT Adoption</title>
+</head>
+<body>
+	<h1>CRNT Adoption</h1>
+	{{ if .Names }}
+	<p><a href="/overview">All queries</a> (<a href="/overview?format=svg">svg</a>, <a href="/overview?format=png">png</a>)</p>
+	<ul>
+		{{ range .Names }}
+		<li><a href="/queries/{{ . }}">{{ . }}</a> (<a href="/queries/{{ . }}?format=svg">svg</a>, <a href="/queries/{{ . }}?format=png">png</a>)</li>
+		{{ end }}
+	</ul>
+	{{ else }}
+	<p>No results yet, run <code>crntmetrics update</code> first.</p>
+	{{ end }}
+
+	<h2>Updates</h2>
+	{{ with .LastRun }}
+	<p>
+		Last run {{ .ID }} started at {{ datetime .StartedAt }}: <strong>{{ .Status }}</strong>
+		{{ if .ErrorCount }}with {{ .ErrorCount }} failed queries{{ end }}
+	</p>
+	{{ if .Errors }}
+	<ul>
+		{{ range .Errors }}<li><code>{{ . }}</code></li>{{ end }}
+	</ul>
+	{{ end }}
+	{{ else }}
+	<p>No updates have run yet.</p>
+	{{ end }}
+	{{ with .Schedule }}
+	<p>
+		{{ if .Running }}An update is running now.{{ else }}Next update at {{ datetime .Next }}.{{ end }}
+		{{ with .LastErr }}The last scheduled update failed: <code>{{ . }}</code>{{ end }}
+	</p>
+	{{ else }}
+	<p>Updates aren't scheduled, start <code>crntmetrics serve --schedule 6h</code> to keep the data fresh.</p>
+	{{ end }}
+</body>
+</html>
+`))
+
+type indexData struct {
+	Names    []string
+	LastRun  *domain.Run
+	Schedule *schedule.Status
+}
+
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	names, err := s.store.LoadQueryNames()
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+
+	runs, err := s.store.LoadRuns(1)
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+
+	data := indexData{Names: names}
+	if len(runs) > 0 {
+		data.LastRun = &runs[0]
+	}
+	if s.scheduler != nil {
+		status := s.scheduler.Status()
+		data.Schedule = &status
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := indexTemplate.Execute(w, data); err != nil {
+		internalError(w, r, err)
+	}
+}
+
+func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	query := r.PathValue("name")
+
+	results, err := s.store.LoadQueryResults(query)
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+
+	if len(results) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	projectNames, err := s.store.LoadProjectNames()
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+
+	title := fmt.Sprintf("CRNT Adoption Rate for %s", query)
+	if format, ok := imageFormat(w, r); !ok {
+		return
+	} else if format != "" {
+		writeImage(w, r, format, func(w io.Writer) error {
+			return chart.WriteLineImage(w, format, title, results)
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	line := chart.NewLine(title, results, projectNames)
+	if err := line.Render(w); err != nil {
+		internalError(w, r, err)
+	}
+}
+
+func (s *Server) handleOverview(w http.ResponseWriter, r *http.Request) {
+	results, err := s.store.LoadResults()
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+
+	if len(results) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	projectNames, err := s.store.LoadProjectNames()
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+
+	title := "CRNT Adoption Rate"
+	if format, ok := imageFormat(w, r); !ok {
+		return
+	} else if format != "" {
+		writeImage(w, r, format, func(w io.Writer) error {
+			return chart.WriteOverviewImage(w, format, title, results)
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	page := chart.NewOverview(title, results, projectNames)
+	if err := page.Render(w); err != nil {
+		internalError(w, r, err)
+	}
+}
+
+// imageFormat returns the static image format requested with ?format=, or an
+// empty format for the interactive HTML chart. It returns false after
+// responding with an error if the format is unknown.
+func imageFormat(w http.ResponseWriter, r *http.Request) (chart.ImageFormat, bool) {
+	value := r.URL.Query().Get("format")
+	if value == "" || value == "html" {
+		return "", true
+	}
+
+	format, err := chart.ParseImageFormat(value)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+	return format, true
+}
+
+// writeImage renders a static chart into a buffer first, so a failure can
+// still be reported as an error instead of a broken image.
+func writeImage(w http.ResponseWriter, r *http.Request, format chart.ImageFormat, render func(w io.Writer) error) {
+	var buf bytes.Buffer
+	if err := render(&buf); err != nil {
+		internalError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Write(buf.Bytes())
+}
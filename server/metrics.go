@@ -0,0 +1,126 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/fwielstra/crntmetrics/domain"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	resultLabels = []string{"query", "project", "project_id"}
+
+	oldUsagesDesc = prometheus.NewDesc(
+		"crnt_adoption_old_usages",
+		"Number of files using the old component in the latest run of the query.",
+		resultLabels, nil,
+	)
+	crntUsagesDesc = prometheus.NewDesc(
+		"crnt_adoption_crnt_usages",
+		"Number of files using the CRNT component in the latest run of the query.",
+		resultLabels, nil,
+	)
+	conversionDesc = prometheus.NewDesc(
+		"crnt_adoption_conversion_ratio",
+		"Share of CRNT usages, crnt / (old + crnt), in the latest run of the query.",
+		resultLabels, nil,
+	)
+	// the finished runs and their errors only go up, until the database is
+	// reset, which Prometheus handles like a restart of the counting process.
+	runsDesc = prometheus.NewDesc(
+		"crnt_update_runs_total",
+		"Number of finished update runs by status.",
+		[]string{"status"}, nil,
+	)
+	runningDesc = prometheus.NewDesc(
+		"crnt_update_runs_running",
+		"Number of update runs in progress.",
+		nil, nil,
+	)
+	errorsDesc = prometheus.NewDesc(
+		"crnt_gitlab_errors_total",
+		"Number of queries that failed in update runs against Gitlab, e.g. because Gitlab returned an error.",
+		nil, nil,
+	)
+	lastRunDesc = prometheus.NewDesc(
+		"crnt_update_last_finished_timestamp_seconds",
+		"Unix time the most recent update run finished.",
+		nil, nil,
+	)
+)
+
+// finishedStatuses are always reported, so the runs counter has a series for
+// every status even before a run had that status.
+var finishedStatuses = []domain.RunStatus{domain.RunStatusSucceeded, domain.RunStatusPartial, domain.RunStatusFailed}
+
+// metricsCollector reads the metrics from the database on every scrape, so
+// they reflect updates run by other processes, e.g. a cron job.
+type metricsCollector struct {
+	store domain.Storage
+}
+
+func (c *metricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- oldUsagesDesc
+	ch <- crntUsagesDesc
+	ch <- conversionDesc
+	ch <- runsDesc
+	ch <- runningDesc
+	ch <- errorsDesc
+	ch <- lastRunDesc
+}
+
+func (c *metricsCollector) Collect(ch chan<- prometheus.Metric) {
+	results, err := c.store.LoadLatestResults()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(oldUsagesDesc, err)
+		return
+	}
+
+	projectNames, err := c.store.LoadProjectNames()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(oldUsagesDesc, err)
+		return
+	}
+
+	for _, res := range results {
+		labels := []string{res.QueryName, projectNames.Name(res.ProjectID), strconv.Itoa(res.ProjectID)}
+		snapshot := domain.Snapshot{OldResults: res.OldResults, CrntResults: res.CrntResults}
+
+		ch <- prometheus.MustNewConstMetric(oldUsagesDesc, prometheus.GaugeValue, float64(res.OldResults), labels...)
+		ch <- prometheus.MustNewConstMetric(crntUsagesDesc, prometheus.GaugeValue, float64(res.CrntResults), labels...)
+		ch <- prometheus.MustNewConstMetric(conversionDesc, prometheus.GaugeValue, snapshot.Conversion(), labels...)
+	}
+
+	counts, err := c.store.LoadRunCounts()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(runsDesc, err)
+		return
+	}
+
+	for _, status := range finishedStatuses {
+		ch <- prometheus.MustNewConstMetric(runsDesc, prometheus.CounterValue, float64(counts.Runs[status]), string(status))
+	}
+	ch <- prometheus.MustNewConstMetric(runningDesc, prometheus.GaugeValue, float64(counts.Runs[domain.RunStatusRunning]))
+	ch <- prometheus.MustNewConstMetric(errorsDesc, prometheus.CounterValue, float64(counts.GitlabErrors))
+
+	if !counts.LastFinishedAt.IsZero() {
+		ch <- prometheus.MustNewConstMetric(lastRunDesc, prometheus.GaugeValue, float64(counts.LastFinishedAt.Unix()))
+	}
+}
+
+// metricsHandler serves the adoption metrics, plus the standard Go and
+// process metrics, in the Prometheus exposition format.
+func metricsHandler(store domain.Storage) http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		&metricsCollector{store: store},
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{ErrorLog: log.Default()})
+}
@@ -0,0 +1,50 @@
+// Package server serves the stored adoption results over HTTP.
+package server
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/fwielstra/crntmetrics/domain"
+	"github.com/fwielstra/crntmetrics/schedule"
+)
+
+// Server renders dashboards from the results in the database.
+type Server struct {
+	store domain.Storage
+	mux   *http.ServeMux
+	// scheduler runs the scheduled updates, nil if updates aren't scheduled.
+	scheduler *schedule.Scheduler
+}
+
+// New creates a server; scheduler is shown on the dashboard and may be nil.
+func New(store domain.Storage, scheduler *schedule.Scheduler) *Server {
+	s := &Server{
+		store:     store,
+		mux:       http.NewServeMux(),
+		scheduler: scheduler,
+	}
+
+	s.mux.HandleFunc("GET /{$}", s.handleIndex)
+	s.mux.HandleFunc("GET /overview", s.handleOverview)
+	s.mux.HandleFunc("GET /queries/{name}", s.handleQuery)
+
+	s.mux.HandleFunc("GET /api/queries", s.handleAPIQueries)
+	s.mux.HandleFunc("GET /api/queries/{name}/results", s.handleAPIQueryResults)
+	s.mux.HandleFunc("GET /api/projects", s.handleAPIProjects)
+
+	s.mux.Handle("GET /metrics", metricsHandler(store))
+
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// internalError logs the actual error and returns a generic message, we don't
+// want to leak database errors to the browser.
+func internalError(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
@@ -0,0 +1,207 @@
+package server_test
+
+import (
+	"encoding/json"
+	"errors"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fwielstra/crntmetrics/domain"
+	"github.com/fwielstra/crntmetrics/server"
+	"github.com/fwielstra/crntmetrics/storage"
+)
+
+func day(d int) time.Time {
+	return time.Date(2025, 6, d, 12, 0, 0, 0, time.UTC)
+}
+
+// newServer serves a SQLite database with two snapshots of the icon query, one
+// of the button query and a finished and a running update run.
+func newServer(t *testing.T) http.Handler {
+	t.Helper()
+
+	store, err := storage.Open(filepath.Join(t.TempDir(), "adoption.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	if _, err := store.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.SaveResults([]domain.ResultRow{
+		{Timestamp: day(1), ProjectID: 62, QueryName: "icon", OldResults: 10, CrntResults: 2},
+		{Timestamp: day(8), ProjectID: 62, QueryName: "icon", OldResults: 8, CrntResults: 4},
+		{Timestamp: day(8), ProjectID: 62, QueryName: "button", OldResults: 3, CrntResults: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveProjects([]*domain.Project{{ID: 62, Name: "web", Namespace: "shop/frontend"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	finished := &domain.Run{StartedAt: day(8), GitlabURL: "https://gitlab.example.com/api/v4/", Status: domain.RunStatusRunning}
+	if err := store.StartRun(finished); err != nil {
+		t.Fatal(err)
+	}
+	finished.Finish(day(8).Add(time.Minute), 2, []error{errors.New("500 Internal Server Error")})
+	if err := store.FinishRun(finished); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StartRun(&domain.Run{StartedAt: day(9), Status: domain.RunStatusRunning}); err != nil {
+		t.Fatal(err)
+	}
+
+	return server.New(store, nil)
+}
+
+func get(t *testing.T, handler http.Handler, path string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestAPI(t *testing.T) {
+	handler := newServer(t)
+
+	tests := []struct {
+		path   string
+		status int
+		want   string
+	}{
+		{"/api/queries", http.StatusOK, `["button","icon"]`},
+		{"/api/queries/icon/results?from=2025-06-02", http.StatusOK,
+			`[{"timestamp":"2025-06-08T12:00:00Z","projectId":62,"query":"icon","oldResults":8,"crntResults":4}]`},
+		{"/api/queries/icon/results?to=2025-05-31", http.StatusOK, `[]`},
+		{"/api/queries/nope/results", http.StatusNotFound, `{"error":"unknown query \"nope\""}`},
+		{"/api/queries/icon/results?from=yesterday", http.StatusBadRequest,
+			`{"error":"invalid from: expected a date (2006-01-02) or RFC 3339 timestamp, got \"yesterday\""}`},
+		{"/api/projects", http.StatusOK, `[{"id":62,"name":"web","namespace":"shop/frontend"}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := get(t, handler, tt.path)
+
+			if rec.Code != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, rec.Code)
+			}
+			if contentType := rec.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("expected JSON, got %s", contentType)
+			}
+			if !json.Valid(rec.Body.Bytes()) {
+				t.Fatalf("expected valid JSON, got %s", rec.Body)
+			}
+			// results are stored in milliseconds in local time, so compare the
+			// timestamps as UTC.
+			if got := utcTimestamps(t, rec.Body.Bytes()); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+// utcTimestamps re-encodes a result list with its timestamps in UTC, and
+// returns any other JSON compacted as is.
+func utcTimestamps(t *testing.T, body []byte) string {
+	t.Helper()
+
+	var results []domain.ResultRow
+	if err := json.Unmarshal(body, &results); err == nil && len(results) > 0 && !results[0].Timestamp.IsZero() {
+		for i := range results {
+			results[i].Timestamp = results[i].Timestamp.UTC()
+		}
+		encoded, err := json.Marshal(results)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(encoded)
+	}
+
+	return strings.TrimSpace(string(body))
+}
+
+func TestImages(t *testing.T) {
+	handler := newServer(t)
+
+	tests := []struct {
+		path        string
+		status      int
+		contentType string
+	}{
+		{"/queries/icon?format=svg", http.StatusOK, "image/svg+xml"},
+		{"/queries/icon?format=png", http.StatusOK, "image/png"},
+		{"/overview?format=svg", http.StatusOK, "image/svg+xml"},
+		{"/overview?format=png", http.StatusOK, "image/png"},
+		{"/queries/icon", http.StatusOK, "text/html; charset=utf-8"},
+		{"/queries/icon?format=gif", http.StatusBadRequest, "text/plain; charset=utf-8"},
+		{"/queries/nope?format=svg", http.StatusNotFound, "text/plain; charset=utf-8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := get(t, handler, tt.path)
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body)
+			}
+			if contentType := rec.Header().Get("Content-Type"); contentType != tt.contentType {
+				t.Errorf("expected %s, got %s", tt.contentType, contentType)
+			}
+
+			switch tt.contentType {
+			case "image/svg+xml":
+				if !strings.HasPrefix(rec.Body.String(), "<svg") {
+					t.Errorf("expected an SVG, got %.100s", rec.Body)
+				}
+			case "image/png":
+				if _, err := png.DecodeConfig(rec.Body); err != nil {
+					t.Errorf("expected a PNG: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	rec := get(t, newServer(t), "/metrics")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+
+	body, err := io.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(body), "\n")
+
+	for _, want := range []string{
+		`# TYPE crnt_adoption_old_usages gauge`,
+		`crnt_adoption_old_usages{project="web",project_id="62",query="icon"} 8`,
+		`crnt_adoption_crnt_usages{project="web",project_id="62",query="icon"} 4`,
+		`crnt_adoption_conversion_ratio{project="web",project_id="62",query="button"} 0.25`,
+		`# TYPE crnt_update_runs_total counter`,
+		`crnt_update_runs_total{status="partial"} 1`,
+		`crnt_update_runs_total{status="succeeded"} 0`,
+		`crnt_update_runs_total{status="failed"} 0`,
+		`# TYPE crnt_update_runs_running gauge`,
+		`crnt_update_runs_running 1`,
+		`# TYPE crnt_gitlab_errors_total counter`,
+		`crnt_gitlab_errors_total 1`,
+		`crnt_update_last_finished_timestamp_seconds 1.74938406e+09`,
+	} {
+		if !slices.Contains(lines, want) {
+			t.Errorf("expected the line %s in:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/fwielstra/crntmetrics/domain"
+)
+
+// Import merges the history of another database in a single transaction.
+func (s *Store) Import(history domain.History) (domain.ImportCounts, error) {
+	var counts domain.ImportCounts
+
+	err := s.withTransaction(func(tx *sql.Tx) error {
+		// runs get a new ID in this database; results follow their run.
+		runIDs := make(map[int64]int64, len(history.Runs))
+		for _, run := range history.Runs {
+			exportedID := run.ID
+			imported, err := importRun(tx, &run)
+			if err != nil {
+				return fmt.Errorf("error importing run %d: %w", exportedID, err)
+			}
+			runIDs[exportedID] = run.ID
+			if imported {
+				counts.Runs++
+			}
+		}
+
+		results := make([]domain.ResultRow, len(history.Results))
+		for i, res := range history.Results {
+			res.RunID = runIDs[res.RunID]
+			results[i] = res
+		}
+
+		var err error
+		if counts.Results, err = importResults(tx, results); err != nil {
+			return fmt.Errorf("error importing results: %w", err)
+		}
+		if err := saveProjects(tx, history.Projects); err != nil {
+			return fmt.Errorf("error importing projects: %w", err)
+		}
+		if err := saveQueryVersions(tx, history.QueryVersions); err != nil {
+			return fmt.Errorf("error importing query versions: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return domain.ImportCounts{}, err
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,53 @@
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/fwielstra/crntmetrics/domain"
+)
+
+func (s *Store) SaveMatches(matches []domain.Match) error {
+	return s.withTransaction(func(tx *sql.Tx) error {
+		stmt, err := tx.Prepare("INSERT INTO matches (runId, timestamp, projectId, query, path, ref, startLine, snippet) VALUES (?, ?, ?, ?, ?, ?, ?, ?);")
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, m := range matches {
+			if _, err := stmt.Exec(nullInt64(m.RunID), m.Timestamp.UnixMilli(), m.ProjectID, m.QueryName, m.Path, m.Ref, m.StartLine, m.Snippet); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// LoadLatestMatches loads the matches of the query in the most recent
+// finished run with details, ordered by project and path. Runs that found
+// no matches don't store any, so the run is looked up rather than the most
+// recent matches.
+func (s *Store) LoadLatestMatches(query string) ([]domain.Match, error) {
+	rows, err := s.db.Query(`SELECT COALESCE(runId, 0), timestamp, projectId, query, path, COALESCE(ref, ''), COALESCE(startLine, 0), COALESCE(snippet, '')
+		FROM matches
+		WHERE query=? AND runId = (SELECT id FROM runs WHERE details=1 AND status IN (?, ?) ORDER BY startedAt DESC, id DESC LIMIT 1)
+		ORDER BY projectId ASC, path ASC, startLine ASC;`, query, domain.RunStatusSucceeded, domain.RunStatusPartial)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matches []domain.Match
+	for rows.Next() {
+		var m domain.Match
+		var ts int64
+		if err := rows.Scan(&m.RunID, &ts, &m.ProjectID, &m.QueryName, &m.Path, &m.Ref, &m.StartLine, &m.Snippet); err != nil {
+			return nil, err
+		}
+		m.Timestamp = time.UnixMilli(ts)
+		matches = append(matches, m)
+	}
+
+	return matches, rows.Err()
+}
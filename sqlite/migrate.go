@@ -2,28 +2,183 @@ package sqlite
 
 import (
 	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
 	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fwielstra/crntmetrics/domain"
 )
 
-const createResultsTable = `
-CREATE TABLE IF NOT EXISTS results (
-	timestamp DATETIME NOT NULL,
-	projectId INTEGER,
-	query TEXT,
-	oldResults INTEGER,
-	crntResults INTEGER
+// migrations are numbered sql files, e.g. 0001_create_results.sql, applied in
+// order of their number. Never edit a migration that has been released, add a
+// new one instead.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+const createMigrationsTable = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	appliedAt INTEGER NOT NULL
 );
 `
 
-// TODO: add db versioning to check if migration is needed.
-func MigrateTables(db *sql.DB) error {
-	log.Println("Migrating tables...")
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+type migrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
 
-	if _, err := db.Exec(createResultsTable); err != nil {
-		return err
+// Migrations returns all migrations embedded in the binary, ordered by version.
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
 	}
 
-	log.Print("Tables created")
+	migrations := make([]Migration, 0, len(entries))
+	seen := make(map[int]string)
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".sql")
+		number, description, found := strings.Cut(name, "_")
+		version, err := strconv.Atoi(number)
+		if !found || err != nil {
+			return nil, fmt.Errorf("sqlite.Migrations(): invalid migration file name %s, expected <version>_<name>.sql", entry.Name())
+		}
+
+		if other, exists := seen[version]; exists {
+			return nil, fmt.Errorf("sqlite.Migrations(): duplicate migration version %d in %s and %s", version, other, entry.Name())
+		}
+		seen[version] = entry.Name()
+
+		contents, err := migrationFiles.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, Migration{
+			Version: version,
+			Name:    description,
+			SQL:     string(contents),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Migrate applies all migrations that have not been applied yet. Each
+// migration runs in its own transaction together with its bookkeeping, so a
+// failing migration leaves the database at the previous version. Returns the
+// number of migrations applied.
+func (s *Store) Migrate() (int, error) {
+	statuses, err := s.migrationStatuses()
+	if err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	for _, status := range statuses {
+		if status.Applied {
+			continue
+		}
+
+		log.Printf("applying migration %d %s", status.Version, status.Name)
+
+		err := s.withTransaction(func(tx *sql.Tx) error {
+			if _, err := tx.Exec(status.SQL); err != nil {
+				return err
+			}
+
+			_, err := tx.Exec("INSERT INTO schema_migrations (version, name, appliedAt) VALUES (?, ?, ?)", status.Version, status.Name, time.Now().UnixMilli())
+			return err
+		})
+
+		if err != nil {
+			return applied, fmt.Errorf("sqlite.Migrate(): error applying migration %d %s: %w", status.Version, status.Name, err)
+		}
+
+		applied++
+	}
+
+	return applied, nil
+}
+
+// MigrationStatuses returns all known migrations and whether they have been applied.
+func (s *Store) MigrationStatuses() ([]domain.MigrationStatus, error) {
+	statuses, err := s.migrationStatuses()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]domain.MigrationStatus, len(statuses))
+	for i, status := range statuses {
+		result[i] = domain.MigrationStatus{
+			Version:   status.Version,
+			Name:      status.Name,
+			Applied:   status.Applied,
+			AppliedAt: status.AppliedAt,
+		}
+	}
+
+	return result, nil
+}
+
+func (s *Store) migrationStatuses() ([]migrationStatus, error) {
+	if _, err := s.db.Exec(createMigrationsTable); err != nil {
+		return nil, fmt.Errorf("sqlite.migrationStatuses(): error creating migrations table: %w", err)
+	}
+
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query("SELECT version, appliedAt FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("sqlite.migrationStatuses(): error loading applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	appliedAt := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var ts int64
+		if err := rows.Scan(&version, &ts); err != nil {
+			return nil, err
+		}
+		appliedAt[version] = time.UnixMilli(ts)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]migrationStatus, len(migrations))
+	for i, m := range migrations {
+		at, applied := appliedAt[m.Version]
+		statuses[i] = migrationStatus{
+			Migration: m,
+			Applied:   applied,
+			AppliedAt: at,
+		}
+	}
 
-	return nil
+	return statuses, nil
 }
@@ -0,0 +1,8 @@
+-- IF NOT EXISTS because databases created before migrations existed already have this table.
+CREATE TABLE IF NOT EXISTS results (
+	timestamp DATETIME NOT NULL,
+	projectId INTEGER,
+	query TEXT,
+	oldResults INTEGER,
+	crntResults INTEGER
+);
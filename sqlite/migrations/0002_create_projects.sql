@@ -0,0 +1,23 @@
+-- Older versions of this tool created a projects table outside of migrations
+-- with a different shape. Make sure it exists so it can be copied over, then
+-- replace it with the new table.
+CREATE TABLE IF NOT EXISTS projects (
+	id INTEGER PRIMARY KEY,
+	name TEXT,
+	nameWithNamespace TEXT,
+	url TEXT
+);
+
+CREATE TABLE projects_new (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	namespace TEXT,
+	url TEXT
+);
+
+INSERT INTO projects_new (id, name, url)
+SELECT id, COALESCE(nameWithNamespace, name, CAST(id AS TEXT)), url FROM projects;
+
+DROP TABLE projects;
+
+ALTER TABLE projects_new RENAME TO projects;
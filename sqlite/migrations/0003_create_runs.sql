@@ -0,0 +1,16 @@
+CREATE TABLE runs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	startedAt INTEGER NOT NULL,
+	finishedAt INTEGER,
+	gitlabUrl TEXT,
+	configHash TEXT,
+	toolVersion TEXT,
+	status TEXT NOT NULL,
+	errorCount INTEGER NOT NULL DEFAULT 0,
+	errors TEXT
+);
+
+-- results stored before runs were recorded don't have a run.
+ALTER TABLE results ADD COLUMN runId INTEGER REFERENCES runs(id);
+
+CREATE INDEX results_run ON results (runId);
@@ -0,0 +1,14 @@
+-- individual search results of the old query of a pair, stored when update
+-- runs with --details, to list the files that still need migrating.
+CREATE TABLE matches (
+	runId INTEGER REFERENCES runs(id),
+	timestamp INTEGER NOT NULL,
+	projectId INTEGER NOT NULL,
+	query TEXT NOT NULL,
+	path TEXT NOT NULL,
+	ref TEXT,
+	startLine INTEGER,
+	snippet TEXT
+);
+
+CREATE INDEX matches_query_run ON matches (query, runId);
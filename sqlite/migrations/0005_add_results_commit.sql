@@ -0,0 +1,5 @@
+-- results backfilled from the git history of a project record the commit
+-- they were measured at, so a backfill can skip commits it already did.
+ALTER TABLE results ADD COLUMN commitSha TEXT;
+
+CREATE INDEX results_project_commit ON results (projectId, commitSha);
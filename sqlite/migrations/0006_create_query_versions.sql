@@ -0,0 +1,14 @@
+-- every distinct definition of a query pair, identified by a hash of its
+-- scope and queries, and the version each result was measured with, so a
+-- change to a query can be told apart from a change in usages.
+CREATE TABLE queryVersions (
+	query TEXT NOT NULL,
+	hash TEXT NOT NULL,
+	scope TEXT NOT NULL,
+	old TEXT NOT NULL,
+	crnt TEXT NOT NULL,
+	validFrom INTEGER NOT NULL,
+	PRIMARY KEY (query, hash)
+);
+
+ALTER TABLE results ADD COLUMN queryHash TEXT;
@@ -0,0 +1,3 @@
+-- runs with --details store every match of the old queries and count those,
+-- so the worklist knows which run is the latest to have looked.
+ALTER TABLE runs ADD COLUMN details INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,118 @@
+package sqlite
+
+import (
+	"database/sql"
+
+	"github.com/fwielstra/crntmetrics/domain"
+)
+
+// SaveProjects inserts the projects, or updates them if they already exist.
+func (s *Store) SaveProjects(projects []*domain.Project) error {
+	return s.withTransaction(func(tx *sql.Tx) error {
+		return saveProjects(tx, projects)
+	})
+}
+
+func saveProjects(tx *sql.Tx, projects []*domain.Project) error {
+	stmt, err := tx.Prepare(`INSERT INTO projects (id, name, namespace, url) VALUES (?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET name = excluded.name, namespace = excluded.namespace, url = excluded.url;`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, p := range projects {
+		if _, err := stmt.Exec(p.ID, p.Name, p.Namespace, p.URL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadProjects returns the projects that have results, with their name and URL
+// if they are known in the projects table.
+func (s *Store) LoadProjects() ([]domain.Project, error) {
+	rows, err := s.db.Query(`SELECT r.projectId, COALESCE(p.name, ''), COALESCE(p.namespace, ''), COALESCE(p.url, '')
+		FROM (SELECT DISTINCT projectId FROM results) r
+		LEFT JOIN projects p ON p.id = r.projectId
+		ORDER BY r.projectId ASC;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var projects []domain.Project
+	for rows.Next() {
+		var p domain.Project
+		if err := rows.Scan(&p.ID, &p.Name, &p.Namespace, &p.URL); err != nil {
+			return nil, err
+		}
+		projects = append(projects, p)
+	}
+
+	return projects, rows.Err()
+}
+
+// LoadProjectNames returns a lookup of project ID to name for all known projects.
+func (s *Store) LoadProjectNames() (domain.ProjectNames, error) {
+	rows, err := s.db.Query("SELECT id, name FROM projects;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := make(domain.ProjectNames)
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		names[id] = name
+	}
+
+	return names, rows.Err()
+}
+
+// LoadProjectURLs returns a lookup of project ID to web URL for all known projects.
+func (s *Store) LoadProjectURLs() (map[int]string, error) {
+	rows, err := s.db.Query("SELECT id, url FROM projects WHERE url IS NOT NULL AND url != '';")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	urls := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var url string
+		if err := rows.Scan(&id, &url); err != nil {
+			return nil, err
+		}
+		urls[id] = url
+	}
+
+	return urls, rows.Err()
+}
+
+// LoadProjectNamespaces returns a lookup of project ID to the full path of its
+// namespace for all known projects.
+func (s *Store) LoadProjectNamespaces() (map[int]string, error) {
+	rows, err := s.db.Query("SELECT id, namespace FROM projects WHERE namespace IS NOT NULL AND namespace != '';")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	namespaces := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var namespace string
+		if err := rows.Scan(&id, &namespace); err != nil {
+			return nil, err
+		}
+		namespaces[id] = namespace
+	}
+
+	return namespaces, rows.Err()
+}
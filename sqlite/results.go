@@ -2,7 +2,6 @@ package sqlite
 
 import (
 	"database/sql"
-	"fmt"
 	"log"
 	"time"
 
@@ -10,12 +9,15 @@ import (
 )
 
 // both sql.DB and sql.Tx implement this
-type Executor interface {
+type executor interface {
 	Exec(query string, args ...any) (sql.Result, error)
 }
 
-func SaveResult(exe Executor, result domain.ResultRow) error {
-	if _, err := exe.Exec("INSERT INTO results (timestamp, projectId, query, oldResults, crntResults) VALUES (?, ?, ?, ?, ?)", result.Timestamp.UnixMilli(), result.ProjectID, result.QueryName, result.OldResults, result.CrntResults); err != nil {
+// the columns to select to scan a result with scanResults.
+const resultColumns = "COALESCE(runId, 0), timestamp, projectId, query, oldResults, crntResults, COALESCE(commitSha, ''), COALESCE(queryHash, '')"
+
+func saveResult(exe executor, result domain.ResultRow) error {
+	if _, err := exe.Exec("INSERT INTO results (runId, timestamp, projectId, query, oldResults, crntResults, commitSha, queryHash) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", nullInt64(result.RunID), result.Timestamp.UnixMilli(), result.ProjectID, result.QueryName, result.OldResults, result.CrntResults, nullString(result.CommitSHA), nullString(result.QueryHash)); err != nil {
 		return err
 	}
 
@@ -25,8 +27,8 @@ func SaveResult(exe Executor, result domain.ResultRow) error {
 }
 
 // utility function to wrap a load of operations in a tx
-func WithTransaction(db *sql.DB, cb func(tx *sql.Tx) error) error {
-	tx, err := db.Begin()
+func (s *Store) withTransaction(cb func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
 	if err != nil {
 		return err
 	}
@@ -40,11 +42,11 @@ func WithTransaction(db *sql.DB, cb func(tx *sql.Tx) error) error {
 	return tx.Commit()
 }
 
-func SaveResults(db *sql.DB, results []domain.ResultRow) error {
-	return WithTransaction(db, func(tx *sql.Tx) error {
+func (s *Store) SaveResults(results []domain.ResultRow) error {
+	return s.withTransaction(func(tx *sql.Tx) error {
 		// we could do a bulk insert query but lazy / not performance critical / this is fast enough.
 		for _, res := range results {
-			if err := SaveResult(tx, res); err != nil {
+			if err := saveResult(tx, res); err != nil {
 				return err
 			}
 		}
@@ -52,43 +54,184 @@ func SaveResults(db *sql.DB, results []domain.ResultRow) error {
 	})
 }
 
-func LoadResults(db *sql.DB) ([]domain.ResultRow, error) {
-	rows, err := db.Query("SELECT timestamp, projectId, query, oldResults, crntResults FROM results where query='fa-icon' ORDER BY timestamp ASC;")
+// importResults saves the results that don't exist yet, identified by their
+// timestamp, project and query, and returns how many were saved.
+func importResults(tx *sql.Tx, results []domain.ResultRow) (int, error) {
+	imported := 0
+	stmt, err := tx.Prepare(`INSERT INTO results (runId, timestamp, projectId, query, oldResults, crntResults, commitSha, queryHash)
+		SELECT ?, ?, ?, ?, ?, ?, ?, ?
+		WHERE NOT EXISTS (SELECT 1 FROM results WHERE timestamp=? AND projectId=? AND query=?);`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	for _, res := range results {
+		ts := res.Timestamp.UnixMilli()
+		inserted, err := stmt.Exec(nullInt64(res.RunID), ts, res.ProjectID, res.QueryName, res.OldResults, res.CrntResults, nullString(res.CommitSHA), nullString(res.QueryHash), ts, res.ProjectID, res.QueryName)
+		if err != nil {
+			return 0, err
+		}
+
+		n, err := inserted.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		imported += int(n)
+	}
+
+	return imported, nil
+}
+
+// LoadResults loads the results of all queries, oldest first.
+func (s *Store) LoadResults() ([]domain.ResultRow, error) {
+	rows, err := s.db.Query("SELECT " + resultColumns + " FROM results ORDER BY timestamp ASC;")
+	if err != nil {
+		return nil, err
+	}
+
+	return scanResults(rows)
+}
+
+func (s *Store) LoadQueryResults(query string) ([]domain.ResultRow, error) {
+	return s.LoadQueryResultsBetween(query, time.Time{}, time.Time{})
+}
+
+// LoadQueryResultsBetween loads the results of a query with a timestamp in
+// [from, to]; a zero from or to leaves that side of the range open.
+func (s *Store) LoadQueryResultsBetween(query string, from time.Time, to time.Time) ([]domain.ResultRow, error) {
+	stmt := "SELECT " + resultColumns + " FROM results WHERE query=?"
+	args := []any{query}
+
+	if !from.IsZero() {
+		stmt += " AND timestamp >= ?"
+		args = append(args, from.UnixMilli())
+	}
+	if !to.IsZero() {
+		stmt += " AND timestamp <= ?"
+		args = append(args, to.UnixMilli())
+	}
+
+	rows, err := s.db.Query(stmt+" ORDER BY timestamp ASC;", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanResults(rows)
+}
+
+// LoadLatestResults loads the most recent results of every query, i.e. the
+// results of the latest update that ran each query.
+func (s *Store) LoadLatestResults() ([]domain.ResultRow, error) {
+	rows, err := s.db.Query("SELECT " + resultColumns + " FROM results r WHERE timestamp = (SELECT MAX(timestamp) FROM results WHERE query = r.query) ORDER BY query ASC, projectId ASC;")
+	if err != nil {
+		return nil, err
+	}
+
+	return scanResults(rows)
+}
+
+// LoadRunResults loads the results of a single update run.
+func (s *Store) LoadRunResults(runID int64) ([]domain.ResultRow, error) {
+	rows, err := s.db.Query("SELECT "+resultColumns+" FROM results WHERE runId=? ORDER BY query ASC, projectId ASC;", runID)
 	if err != nil {
 		return nil, err
 	}
 
+	return scanResults(rows)
+}
+
+// scanResults reads all rows selected with resultColumns and closes them.
+func scanResults(rows *sql.Rows) ([]domain.ResultRow, error) {
+	defer rows.Close()
+
 	var results []domain.ResultRow
 	for rows.Next() {
 		var res domain.ResultRow
 		var ts int64
-		if err := rows.Scan(&ts, &res.ProjectID, &res.QueryName, &res.OldResults, &res.CrntResults); err != nil {
+		if err := rows.Scan(&res.RunID, &ts, &res.ProjectID, &res.QueryName, &res.OldResults, &res.CrntResults, &res.CommitSHA, &res.QueryHash); err != nil {
 			return nil, err
 		}
 		res.Timestamp = time.UnixMilli(ts)
 		results = append(results, res)
 	}
 
-	return results, nil
+	return results, rows.Err()
+}
+
+// nullInt64 stores zero IDs as NULL.
+func nullInt64(v int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: v, Valid: v != 0}
 }
 
-func LoadQueryResults(db *sql.DB, query string) ([]domain.ResultRow, error) {
-	rows, err := db.Query("SELECT timestamp, projectId, query, oldResults, crntResults FROM results where query=? ORDER BY timestamp ASC;", query)
+// nullString stores empty strings as NULL.
+func nullString(v string) sql.NullString {
+	return sql.NullString{String: v, Valid: v != ""}
+}
+
+// LoadBackfilledTimes returns the timestamps of the backfilled results of a
+// project, with the queries that have results at each.
+func (s *Store) LoadBackfilledTimes(projectID int) (map[int64]map[string]bool, error) {
+	rows, err := s.db.Query("SELECT DISTINCT timestamp, query FROM results WHERE projectId=? AND commitSha IS NOT NULL;", projectID)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	var results []domain.ResultRow
+	times := make(map[int64]map[string]bool)
 	for rows.Next() {
-		var res domain.ResultRow
 		var ts int64
-		if err := rows.Scan(&ts, &res.ProjectID, &res.QueryName, &res.OldResults, &res.CrntResults); err != nil {
+		var query string
+		if err := rows.Scan(&ts, &query); err != nil {
 			return nil, err
 		}
-		res.Timestamp = time.UnixMilli(ts)
-		fmt.Printf("%+v\n", res)
-		results = append(results, res)
+		if times[ts] == nil {
+			times[ts] = make(map[string]bool)
+		}
+		times[ts][query] = true
+	}
+
+	return times, rows.Err()
+}
+
+// LoadFirstUpdateTimes returns per query the timestamp of the first result of
+// a project that wasn't backfilled.
+func (s *Store) LoadFirstUpdateTimes(projectID int) (map[string]time.Time, error) {
+	rows, err := s.db.Query("SELECT query, MIN(timestamp) FROM results WHERE projectId=? AND commitSha IS NULL GROUP BY query;", projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	times := make(map[string]time.Time)
+	for rows.Next() {
+		var query string
+		var ts int64
+		if err := rows.Scan(&query, &ts); err != nil {
+			return nil, err
+		}
+		times[query] = time.UnixMilli(ts)
+	}
+
+	return times, rows.Err()
+}
+
+// LoadQueryNames returns the distinct names of all queries that have results, sorted by name.
+func (s *Store) LoadQueryNames() ([]string, error) {
+	rows, err := s.db.Query("SELECT DISTINCT query FROM results ORDER BY query ASC;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
 	}
 
-	return results, nil
+	return names, rows.Err()
 }
@@ -0,0 +1,179 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fwielstra/crntmetrics/domain"
+)
+
+const runColumns = "id, startedAt, COALESCE(finishedAt, 0), COALESCE(gitlabUrl, ''), COALESCE(configHash, ''), COALESCE(toolVersion, ''), details, status, errorCount, COALESCE(errors, '')"
+
+// StartRun inserts a new run and sets its ID.
+func (s *Store) StartRun(run *domain.Run) error {
+	res, err := s.db.Exec("INSERT INTO runs (startedAt, gitlabUrl, configHash, toolVersion, details, status) VALUES (?, ?, ?, ?, ?, ?)",
+		run.StartedAt.UnixMilli(), run.GitlabURL, run.ConfigHash, run.ToolVersion, run.Details, run.Status)
+	if err != nil {
+		return fmt.Errorf("sqlite.StartRun(): error inserting run: %w", err)
+	}
+
+	run.ID, err = res.LastInsertId()
+	return err
+}
+
+// FinishRun stores the finish time, status and errors of a run.
+func (s *Store) FinishRun(run *domain.Run) error {
+	// errors are stored as a JSON array, error messages can span multiple lines.
+	errs, err := json.Marshal(run.Errors)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec("UPDATE runs SET finishedAt=?, status=?, errorCount=?, errors=? WHERE id=?",
+		run.FinishedAt.UnixMilli(), run.Status, run.ErrorCount, string(errs), run.ID)
+	if err != nil {
+		return fmt.Errorf("sqlite.FinishRun(): error updating run %d: %w", run.ID, err)
+	}
+
+	return nil
+}
+
+// importRun saves a run from another database with its ID in this one, or
+// sets the ID of the run that started at the same time on the same Gitlab.
+// Returns whether the run was saved.
+func importRun(tx *sql.Tx, run *domain.Run) (bool, error) {
+	err := tx.QueryRow("SELECT id FROM runs WHERE startedAt=? AND COALESCE(gitlabUrl, '')=?;", run.StartedAt.UnixMilli(), run.GitlabURL).Scan(&run.ID)
+	if err == nil {
+		return false, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+
+	var finishedAt sql.NullInt64
+	var errs sql.NullString
+	if !run.FinishedAt.IsZero() {
+		encoded, err := json.Marshal(run.Errors)
+		if err != nil {
+			return false, err
+		}
+		finishedAt = sql.NullInt64{Int64: run.FinishedAt.UnixMilli(), Valid: true}
+		errs = sql.NullString{String: string(encoded), Valid: true}
+	}
+
+	res, err := tx.Exec("INSERT INTO runs (startedAt, finishedAt, gitlabUrl, configHash, toolVersion, details, status, errorCount, errors) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		run.StartedAt.UnixMilli(), finishedAt, run.GitlabURL, run.ConfigHash, run.ToolVersion, run.Details, run.Status, run.ErrorCount, errs)
+	if err != nil {
+		return false, fmt.Errorf("error inserting run: %w", err)
+	}
+
+	run.ID, err = res.LastInsertId()
+	return true, err
+}
+
+// LoadRuns returns the most recent runs, newest first.
+func (s *Store) LoadRuns(limit int) ([]domain.Run, error) {
+	rows, err := s.db.Query("SELECT "+runColumns+" FROM runs ORDER BY startedAt DESC, id DESC LIMIT ?;", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []domain.Run
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, rows.Err()
+}
+
+// LoadRun returns a single run, or domain.ErrRunNotFound.
+func (s *Store) LoadRun(id int64) (domain.Run, error) {
+	row := s.db.QueryRow("SELECT "+runColumns+" FROM runs WHERE id=?;", id)
+
+	run, err := scanRun(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return run, fmt.Errorf("%w: %d", domain.ErrRunNotFound, id)
+	}
+
+	return run, err
+}
+
+// LoadLatestUpdateRun returns the most recent run that isn't a backfill, or
+// domain.ErrRunNotFound.
+func (s *Store) LoadLatestUpdateRun() (domain.Run, error) {
+	row := s.db.QueryRow("SELECT " + runColumns + ` FROM runs WHERE gitlabUrl IS NULL OR gitlabUrl NOT LIKE 'backfill:%'
+		ORDER BY startedAt DESC, id DESC LIMIT 1;`)
+
+	run, err := scanRun(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return run, domain.ErrRunNotFound
+	}
+
+	return run, err
+}
+
+// both sql.Row and sql.Rows implement this
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRun(row scanner) (domain.Run, error) {
+	var run domain.Run
+	var startedAt, finishedAt int64
+	var errs string
+
+	if err := row.Scan(&run.ID, &startedAt, &finishedAt, &run.GitlabURL, &run.ConfigHash, &run.ToolVersion, &run.Details, &run.Status, &run.ErrorCount, &errs); err != nil {
+		return run, err
+	}
+
+	run.StartedAt = time.UnixMilli(startedAt)
+	if finishedAt != 0 {
+		run.FinishedAt = time.UnixMilli(finishedAt)
+	}
+	if errs != "" {
+		if err := json.Unmarshal([]byte(errs), &run.Errors); err != nil {
+			return run, fmt.Errorf("error decoding errors of run %d: %w", run.ID, err)
+		}
+	}
+
+	return run, nil
+}
+
+// LoadRunCounts counts the runs per status and the errors of the Gitlab runs.
+func (s *Store) LoadRunCounts() (domain.RunCounts, error) {
+	counts := domain.RunCounts{Runs: make(map[domain.RunStatus]int)}
+
+	rows, err := s.db.Query(`SELECT status, COUNT(*),
+		SUM(CASE WHEN gitlabUrl LIKE 'local:%' OR gitlabUrl LIKE 'backfill:%' THEN 0 ELSE errorCount END),
+		COALESCE(MAX(finishedAt), 0)
+		FROM runs GROUP BY status;`)
+	if err != nil {
+		return counts, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var status domain.RunStatus
+		var runs, errs int
+		var finishedAt int64
+		if err := rows.Scan(&status, &runs, &errs, &finishedAt); err != nil {
+			return counts, err
+		}
+
+		counts.Runs[status] = runs
+		counts.GitlabErrors += errs
+		if finishedAt > 0 && time.UnixMilli(finishedAt).After(counts.LastFinishedAt) {
+			counts.LastFinishedAt = time.UnixMilli(finishedAt)
+		}
+	}
+
+	return counts, rows.Err()
+}
@@ -0,0 +1,88 @@
+// Package sqlite stores results in a local SQLite database file.
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fwielstra/crntmetrics/domain"
+
+	_ "modernc.org/sqlite"
+)
+
+// Store implements domain.Storage on a SQLite database. Timestamps are stored
+// as unix milliseconds.
+type Store struct {
+	db   *sql.DB
+	path string
+}
+
+var _ domain.Storage = (*Store)(nil)
+
+// Open opens the SQLite database at path, creating its directory if it
+// doesn't exist yet. Writers wait for each other rather than failing, and
+// readers don't block writers, as serve and a cron job may use the same
+// database at once.
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("sqlite.Open(): error creating database directory: %w", err)
+	}
+
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("sqlite.Open(): error opening database: %w", err)
+	}
+
+	return &Store{db: db, path: path}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Reset copies the database to a timestamped backup file next to it, then
+// drops all tables.
+func (s *Store) Reset() (string, error) {
+	backup := fmt.Sprintf("%s.%s.bak", s.path, time.Now().Format("20060102-150405"))
+	// unlike copying the file, VACUUM INTO makes a consistent copy while
+	// another process writes to it.
+	if _, err := s.db.Exec("VACUUM INTO ?;", backup); err != nil {
+		return "", fmt.Errorf("sqlite.Reset(): error backing up database to %s: %w", backup, err)
+	}
+
+	rows, err := s.db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%';")
+	if err != nil {
+		return backup, err
+	}
+
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			rows.Close()
+			return backup, err
+		}
+		tables = append(tables, table)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return backup, err
+	}
+
+	err = s.withTransaction(func(tx *sql.Tx) error {
+		for _, table := range tables {
+			if _, err := tx.Exec(fmt.Sprintf("DROP TABLE %q;", table)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return backup, fmt.Errorf("sqlite.Reset(): error dropping tables: %w", err)
+	}
+
+	return backup, nil
+}
@@ -0,0 +1,64 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/fwielstra/crntmetrics/domain"
+)
+
+// SaveQueryVersions inserts the versions that don't exist yet; for existing
+// ones, the earliest valid from is kept.
+func (s *Store) SaveQueryVersions(versions []domain.QueryVersion) error {
+	return s.withTransaction(func(tx *sql.Tx) error {
+		return saveQueryVersions(tx, versions)
+	})
+}
+
+func saveQueryVersions(tx *sql.Tx, versions []domain.QueryVersion) error {
+	stmt, err := tx.Prepare(`INSERT INTO queryVersions (query, hash, scope, old, crnt, validFrom) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (query, hash) DO UPDATE SET validFrom = MIN(validFrom, excluded.validFrom);`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, v := range versions {
+		scope, err := json.Marshal(v.Scope)
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.Exec(v.Query, v.Hash, string(scope), v.Old, v.Crnt, v.ValidFrom.UnixMilli()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadQueryVersions loads the versions of all queries, ordered by query and
+// valid from.
+func (s *Store) LoadQueryVersions() ([]domain.QueryVersion, error) {
+	rows, err := s.db.Query("SELECT query, hash, scope, old, crnt, validFrom FROM queryVersions ORDER BY query ASC, validFrom ASC;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []domain.QueryVersion
+	for rows.Next() {
+		var v domain.QueryVersion
+		var scope string
+		var validFrom int64
+		if err := rows.Scan(&v.Query, &v.Hash, &scope, &v.Old, &v.Crnt, &validFrom); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(scope), &v.Scope); err != nil {
+			return nil, err
+		}
+		v.ValidFrom = time.UnixMilli(validFrom)
+		versions = append(versions, v)
+	}
+
+	return versions, rows.Err()
+}
@@ -0,0 +1,53 @@
+// Package storage opens the domain.Storage implementation for a DSN.
+package storage
+
+import (
+	"os"
+	"strings"
+
+	"github.com/fwielstra/crntmetrics/domain"
+	"github.com/fwielstra/crntmetrics/postgres"
+	"github.com/fwielstra/crntmetrics/sqlite"
+)
+
+// EnvVar is the environment variable that can hold the database DSN.
+const EnvVar = "CRNTMETRICS_DATABASE"
+
+// DefaultPath is used if neither a flag nor EnvVar specify a database.
+const DefaultPath = "data/adoption.db"
+
+// DSN returns the database to open; an explicit flag value wins over the
+// environment, which wins over DefaultPath.
+func DSN(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if env, ok := os.LookupEnv(EnvVar); ok && env != "" {
+		return env
+	}
+	return DefaultPath
+}
+
+// Open opens the database at dsn: a postgres:// or postgresql:// URL or a
+// key=value connection string like "host=db dbname=crntmetrics" for a
+// PostgreSQL database, or otherwise the path to a SQLite database file.
+func Open(dsn string) (domain.Storage, error) {
+	if IsPostgres(dsn) {
+		return postgres.Open(dsn)
+	}
+
+	return sqlite.Open(dsn)
+}
+
+// IsPostgres returns true if the DSN is a PostgreSQL URL or key=value
+// connection string.
+func IsPostgres(dsn string) bool {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		return true
+	}
+
+	// a connection string starts with a keyword like host or dbname, a path
+	// to a SQLite file with "=" in it has a path separator or extension first.
+	keyword, _, found := strings.Cut(strings.TrimSpace(dsn), "=")
+	return found && keyword != "" && strings.Trim(keyword, "abcdefghijklmnopqrstuvwxyz_") == ""
+}
@@ -0,0 +1,572 @@
+package storage_test
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fwielstra/crntmetrics/domain"
+	"github.com/fwielstra/crntmetrics/storage"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// postgresEnvVar holds the URL of a PostgreSQL database to run the storage
+// tests against as well; every test gets its own schema in it, which is
+// dropped afterwards.
+const postgresEnvVar = "CRNTMETRICS_TEST_POSTGRES"
+
+// forEachStore runs the test against every storage implementation, each with
+// a new, empty database that hasn't been migrated yet.
+func forEachStore(t *testing.T, test func(t *testing.T, store domain.Storage)) {
+	t.Run("sqlite", func(t *testing.T) {
+		store, err := storage.Open(filepath.Join(t.TempDir(), "adoption.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+
+		test(t, store)
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		dsn := os.Getenv(postgresEnvVar)
+		if dsn == "" {
+			t.Skipf("set $%s to a postgres:// URL to test PostgreSQL", postgresEnvVar)
+		}
+
+		store, err := storage.Open(postgresSchema(t, dsn))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+
+		test(t, store)
+	})
+}
+
+// forEachMigratedStore is forEachStore with the schema up to date.
+func forEachMigratedStore(t *testing.T, test func(t *testing.T, store domain.Storage)) {
+	forEachStore(t, func(t *testing.T, store domain.Storage) {
+		if _, err := store.Migrate(); err != nil {
+			t.Fatal(err)
+		}
+		test(t, store)
+	})
+}
+
+// postgresSchema creates a schema for the test and returns the DSN with it as
+// search path.
+func postgresSchema(t *testing.T, dsn string) string {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	schema := fmt.Sprintf("crntmetrics_test_%d", time.Now().UnixNano())
+	if _, err := db.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := db.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Error(err)
+		}
+	})
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// a timestamp in another timezone than the tests probably run in, with
+// milliseconds, the precision of the SQLite store.
+func at(day int, hour int) time.Time {
+	return time.Date(2025, 6, day, hour, 30, 15, 123_000_000, time.FixedZone("CEST", 2*60*60))
+}
+
+func TestMigrations(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store domain.Storage) {
+		statuses, err := store.MigrationStatuses()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(statuses) == 0 {
+			t.Fatal("expected migrations")
+		}
+		for _, s := range statuses {
+			if s.Applied {
+				t.Errorf("expected migration %d to be pending in a new database", s.Version)
+			}
+		}
+
+		applied, err := store.Migrate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if applied != len(statuses) {
+			t.Errorf("expected %d migrations to be applied, got %d", len(statuses), applied)
+		}
+
+		if applied, err := store.Migrate(); err != nil || applied != 0 {
+			t.Errorf("expected migrating again to apply nothing, got %d, %v", applied, err)
+		}
+
+		statuses, err = store.MigrationStatuses()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range statuses {
+			if !s.Applied || s.AppliedAt.IsZero() {
+				t.Errorf("expected migration %d to be applied, got %+v", s.Version, s)
+			}
+		}
+	})
+}
+
+func TestTimestampRoundTrip(t *testing.T) {
+	forEachMigratedStore(t, func(t *testing.T, store domain.Storage) {
+		run := &domain.Run{StartedAt: at(1, 12), GitlabURL: "https://gitlab.example.com", Status: domain.RunStatusRunning}
+		if err := store.StartRun(run); err != nil {
+			t.Fatal(err)
+		}
+		run.Finish(at(1, 13), 1, nil)
+		if err := store.FinishRun(run); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.SaveResults([]domain.ResultRow{{RunID: run.ID, Timestamp: at(1, 12), ProjectID: 62, QueryName: "icon"}}); err != nil {
+			t.Fatal(err)
+		}
+
+		loaded, err := store.LoadRun(run.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertTime(t, "run start", loaded.StartedAt, at(1, 12))
+		assertTime(t, "run finish", loaded.FinishedAt, at(1, 13))
+
+		results, err := store.LoadQueryResults("icon")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 {
+			t.Fatalf("expected 1 result, got %+v", results)
+		}
+		assertTime(t, "result", results[0].Timestamp, at(1, 12))
+	})
+}
+
+// assertTime checks that a loaded time is the same instant as the saved one,
+// in the local timezone.
+func assertTime(t *testing.T, name string, got time.Time, expected time.Time) {
+	t.Helper()
+	if !got.Equal(expected) {
+		t.Errorf("expected %s time %s, got %s", name, expected, got)
+	}
+	if got.Location() != time.Local {
+		t.Errorf("expected %s time in the local timezone, got %s", name, got.Location())
+	}
+}
+
+func TestLoadQueryResultsBetween(t *testing.T) {
+	forEachMigratedStore(t, func(t *testing.T, store domain.Storage) {
+		var results []domain.ResultRow
+		for day := 1; day <= 4; day++ {
+			results = append(results,
+				domain.ResultRow{Timestamp: at(day, 12), ProjectID: 62, QueryName: "icon", OldResults: day},
+				domain.ResultRow{Timestamp: at(day, 12), ProjectID: 62, QueryName: "button", OldResults: day},
+			)
+		}
+		if err := store.SaveResults(results); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			name     string
+			from, to time.Time
+			expected []int
+		}{
+			{"open range", time.Time{}, time.Time{}, []int{1, 2, 3, 4}},
+			{"inclusive bounds", at(2, 12), at(3, 12), []int{2, 3}},
+			{"open start", time.Time{}, at(2, 12), []int{1, 2}},
+			{"open end", at(3, 12), time.Time{}, []int{3, 4}},
+			{"empty range", at(2, 13), at(3, 11), nil},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				got, err := store.LoadQueryResultsBetween("icon", tt.from, tt.to)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var days []int
+				for _, res := range got {
+					if res.QueryName != "icon" {
+						t.Errorf("expected only results of icon, got %+v", res)
+					}
+					days = append(days, res.OldResults)
+				}
+				if fmt.Sprint(days) != fmt.Sprint(tt.expected) {
+					t.Errorf("expected days %v, oldest first, got %v", tt.expected, days)
+				}
+			})
+		}
+	})
+}
+
+func TestLoadLatestResults(t *testing.T) {
+	forEachMigratedStore(t, func(t *testing.T, store domain.Storage) {
+		// button didn't run in the latest update, so its latest results are
+		// older than those of icon.
+		err := store.SaveResults([]domain.ResultRow{
+			{Timestamp: at(1, 12), ProjectID: 62, QueryName: "icon", OldResults: 10},
+			{Timestamp: at(1, 12), ProjectID: 62, QueryName: "button", OldResults: 20},
+			{Timestamp: at(2, 12), ProjectID: 3202, QueryName: "icon", OldResults: 8},
+			{Timestamp: at(2, 12), ProjectID: 62, QueryName: "icon", OldResults: 9},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := store.LoadLatestResults()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []struct {
+			query   string
+			project int
+			old     int
+		}{
+			{"button", 62, 20},
+			{"icon", 62, 9},
+			{"icon", 3202, 8},
+		}
+		if len(got) != len(expected) {
+			t.Fatalf("expected %d results, got %+v", len(expected), got)
+		}
+		for i, e := range expected {
+			if got[i].QueryName != e.query || got[i].ProjectID != e.project || got[i].OldResults != e.old {
+				t.Errorf("expected result %d to be %+v, got %+v", i, e, got[i])
+			}
+		}
+	})
+}
+
+func TestLoadRunCounts(t *testing.T) {
+	forEachMigratedStore(t, func(t *testing.T, store domain.Storage) {
+		counts, err := store.LoadRunCounts()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(counts.Runs) != 0 || counts.GitlabErrors != 0 || !counts.LastFinishedAt.IsZero() {
+			t.Errorf("expected no runs, got %+v", counts)
+		}
+
+		finish := func(source string, started time.Time, finished time.Time, total int, errs []error) {
+			t.Helper()
+			run := &domain.Run{StartedAt: started, GitlabURL: source, Status: domain.RunStatusRunning}
+			if err := store.StartRun(run); err != nil {
+				t.Fatal(err)
+			}
+			if finished.IsZero() {
+				return
+			}
+			run.Finish(finished, total, errs)
+			if err := store.FinishRun(run); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		gitlab := "https://gitlab.example.com/api/v4/"
+		finish(gitlab, at(1, 12), at(1, 13), 2, nil)
+		finish(gitlab, at(2, 12), at(2, 14), 3, []error{errors.New("timeout"), errors.New("500")})
+		finish(gitlab, at(3, 12), at(3, 13), 1, []error{errors.New("timeout")})
+		// errors of the local backend and backfills aren't Gitlab errors.
+		finish("local:62=../web", at(3, 14), at(3, 15), 2, []error{errors.New("not a git repository")})
+		finish("backfill:62=../web", at(3, 16), at(3, 17), 2, []error{errors.New("not a git repository")})
+		finish(gitlab, at(4, 12), time.Time{}, 0, nil)
+
+		counts, err = store.LoadRunCounts()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := map[domain.RunStatus]int{
+			domain.RunStatusSucceeded: 1,
+			domain.RunStatusPartial:   3,
+			domain.RunStatusFailed:    1,
+			domain.RunStatusRunning:   1,
+		}
+		if fmt.Sprint(counts.Runs) != fmt.Sprint(expected) {
+			t.Errorf("expected runs %v, got %v", expected, counts.Runs)
+		}
+		if counts.GitlabErrors != 3 {
+			t.Errorf("expected 3 Gitlab errors, got %d", counts.GitlabErrors)
+		}
+		assertTime(t, "last finished", counts.LastFinishedAt, at(3, 17))
+	})
+}
+
+func TestLoadRunNotFound(t *testing.T) {
+	forEachMigratedStore(t, func(t *testing.T, store domain.Storage) {
+		if _, err := store.LoadRun(42); !errors.Is(err, domain.ErrRunNotFound) {
+			t.Errorf("expected ErrRunNotFound, got %v", err)
+		}
+	})
+}
+
+func TestLoadLatestMatches(t *testing.T) {
+	forEachMigratedStore(t, func(t *testing.T, store domain.Storage) {
+		update := func(started time.Time, details bool, paths ...string) {
+			t.Helper()
+			run := &domain.Run{StartedAt: started, Details: details, Status: domain.RunStatusRunning}
+			if err := store.StartRun(run); err != nil {
+				t.Fatal(err)
+			}
+
+			matches := make([]domain.Match, len(paths))
+			for i, path := range paths {
+				matches[i] = domain.Match{RunID: run.ID, Timestamp: started, QueryName: "icon", SearchResult: domain.SearchResult{ProjectID: 62, Path: path}}
+			}
+			if err := store.SaveMatches(matches); err != nil {
+				t.Fatal(err)
+			}
+
+			run.Finish(started.Add(time.Minute), 1, nil)
+			if err := store.FinishRun(run); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		paths := func() []string {
+			t.Helper()
+			matches, err := store.LoadLatestMatches("icon")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var paths []string
+			for _, m := range matches {
+				paths = append(paths, m.Path)
+			}
+			return paths
+		}
+
+		update(at(1, 12), true, "b.tsx", "a.tsx")
+		if got := paths(); fmt.Sprint(got) != "[a.tsx b.tsx]" {
+			t.Errorf("expected the matches of the first run, sorted, got %v", got)
+		}
+
+		// an update without details doesn't change the worklist.
+		update(at(2, 12), false)
+		if got := paths(); fmt.Sprint(got) != "[a.tsx b.tsx]" {
+			t.Errorf("expected the matches of the first run, got %v", got)
+		}
+
+		update(at(3, 12), true, "a.tsx")
+		if got := paths(); fmt.Sprint(got) != "[a.tsx]" {
+			t.Errorf("expected the matches of the latest run, got %v", got)
+		}
+
+		// the latest run with details found nothing, so nothing is left to migrate.
+		update(at(4, 12), true)
+		if got := paths(); len(got) != 0 {
+			t.Errorf("expected no matches after a run without any, got %v", got)
+		}
+	})
+}
+
+// history is an export of a database with a run per day, each with a result.
+func history(days ...int) domain.History {
+	var h domain.History
+	for _, day := range days {
+		run := domain.Run{ID: int64(day), StartedAt: at(day, 12), GitlabURL: "https://gitlab.example.com", Status: domain.RunStatusRunning}
+		run.Finish(at(day, 13), 1, nil)
+		h.Runs = append(h.Runs, run)
+		h.Results = append(h.Results, domain.ResultRow{RunID: run.ID, Timestamp: at(day, 12), ProjectID: 62, QueryName: "icon", OldResults: day})
+	}
+	h.Projects = []*domain.Project{{ID: 62, Name: "frontend"}}
+	h.QueryVersions = []domain.QueryVersion{{Query: "icon", Hash: "abc", Old: "fa-icon", Crnt: "crnt-icon", ValidFrom: at(days[0], 12)}}
+	return h
+}
+
+func TestImport(t *testing.T) {
+	forEachMigratedStore(t, func(t *testing.T, store domain.Storage) {
+		counts, err := store.Import(history(1, 2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if counts != (domain.ImportCounts{Runs: 2, Results: 2}) {
+			t.Errorf("expected 2 runs and results to be imported, got %+v", counts)
+		}
+
+		counts, err = store.Import(history(1, 2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if counts != (domain.ImportCounts{}) {
+			t.Errorf("expected importing the same history twice to import nothing, got %+v", counts)
+		}
+
+		// an overlapping export of another database only adds what's new.
+		counts, err = store.Import(history(2, 3))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if counts != (domain.ImportCounts{Runs: 1, Results: 1}) {
+			t.Errorf("expected only day 3 to be imported, got %+v", counts)
+		}
+
+		runs, err := store.LoadRuns(10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(runs) != 3 {
+			t.Fatalf("expected 3 runs, got %+v", runs)
+		}
+		runIDs := make(map[time.Time]int64)
+		for _, run := range runs {
+			if run.Status != domain.RunStatusSucceeded || run.FinishedAt.IsZero() {
+				t.Errorf("expected the imported run to be finished, got %+v", run)
+			}
+			runIDs[run.StartedAt.UTC()] = run.ID
+		}
+
+		results, err := store.LoadQueryResults("icon")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 3 {
+			t.Fatalf("expected 3 results, got %+v", results)
+		}
+		for _, res := range results {
+			if runID := runIDs[res.Timestamp.UTC()]; res.RunID != runID {
+				t.Errorf("expected result of day %d to belong to run %d, got %d", res.OldResults, runID, res.RunID)
+			}
+		}
+
+		versions, err := store.LoadQueryVersions()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(versions) != 1 || !versions[0].ValidFrom.Equal(at(1, 12)) {
+			t.Errorf("expected a single version valid from the earliest import, got %+v", versions)
+		}
+
+		names, err := store.LoadProjectNames()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if names.Name(62) != "frontend" {
+			t.Errorf("expected the project name to be imported, got %q", names.Name(62))
+		}
+	})
+}
+
+func TestLoadFirstUpdateTimes(t *testing.T) {
+	forEachMigratedStore(t, func(t *testing.T, store domain.Storage) {
+		err := store.SaveResults([]domain.ResultRow{
+			// backfilled results don't count as updates.
+			{Timestamp: at(1, 12), ProjectID: 62, QueryName: "icon", CommitSHA: "abc123"},
+			{Timestamp: at(2, 12), ProjectID: 62, QueryName: "icon"},
+			{Timestamp: at(3, 12), ProjectID: 62, QueryName: "icon"},
+			{Timestamp: at(3, 12), ProjectID: 62, QueryName: "button"},
+			{Timestamp: at(1, 12), ProjectID: 3202, QueryName: "icon"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := store.LoadFirstUpdateTimes(62)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 2 {
+			t.Fatalf("expected the first update of 2 queries, got %v", got)
+		}
+		assertTime(t, "first icon update", got["icon"], at(2, 12))
+		assertTime(t, "first button update", got["button"], at(3, 12))
+	})
+}
+
+func TestLoadProjectNamespaces(t *testing.T) {
+	forEachMigratedStore(t, func(t *testing.T, store domain.Storage) {
+		err := store.SaveProjects([]*domain.Project{
+			{ID: 62, Name: "web", Namespace: "shop/frontend"},
+			// projects without a namespace are left out.
+			{ID: 3202, Name: "app"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := store.LoadProjectNamespaces()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 || got[62] != "shop/frontend" {
+			t.Errorf("expected only the namespace of project 62, got %v", got)
+		}
+	})
+}
+
+func TestIsPostgres(t *testing.T) {
+	tests := []struct {
+		dsn  string
+		want bool
+	}{
+		{"postgres://crnt@db.example.com/crntmetrics", true},
+		{"postgresql://crnt@db.example.com/crntmetrics", true},
+		{"host=db.example.com user=crnt dbname=crntmetrics", true},
+		{" dbname=crntmetrics", true},
+		{"data/adoption.db", false},
+		{"adoption.db", false},
+		{"data/run=2/adoption.db", false},
+		{"adoption-v=2.db", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := storage.IsPostgres(tt.dsn); got != tt.want {
+			t.Errorf("IsPostgres(%q) = %v, want %v", tt.dsn, got, tt.want)
+		}
+	}
+}
+
+func TestLoadLatestUpdateRun(t *testing.T) {
+	forEachMigratedStore(t, func(t *testing.T, store domain.Storage) {
+		if _, err := store.LoadLatestUpdateRun(); !errors.Is(err, domain.ErrRunNotFound) {
+			t.Errorf("expected ErrRunNotFound without runs, got %v", err)
+		}
+
+		for _, run := range []*domain.Run{
+			{StartedAt: at(1, 12), GitlabURL: "https://gitlab.example.com/api/v4/"},
+			{StartedAt: at(2, 12), GitlabURL: "local:62=../web"},
+			// backfills run later, but measure the past.
+			{StartedAt: at(3, 12), GitlabURL: "backfill:62=../web"},
+		} {
+			run.Status = domain.RunStatusRunning
+			if err := store.StartRun(run); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		run, err := store.LoadLatestUpdateRun()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertTime(t, "latest update", run.StartedAt, at(2, 12))
+	})
+}